@@ -0,0 +1,152 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+func init() {
+	registerSource("activitypub", sourceDef{
+		new: func(cred *credentials) Source { return &activityPubSource{} },
+	})
+}
+
+// activityPubSource walks the public outbox of any ActivityPub actor, e.g.
+// Pleroma, PeerTube, WriteFreely, etc. The user is either the actor URL or
+// @user@instance, resolved with WebFinger.
+type activityPubSource struct{}
+
+func (a *activityPubSource) Key(user string) string {
+	return "activitypub:" + strings.TrimPrefix(user, "@")
+}
+
+// apGet fetches an ActivityStreams document.
+func apGet(ctx context.Context, u string, out interface{}) error {
+	req, err := newRequest(ctx, u, "")
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", `application/activity+json, application/ld+json; profile="https://www.w3.org/ns/activitystreams"`)
+	_, err = doJSON(req, out)
+	return err
+}
+
+// apPage is either an OrderedCollection or an OrderedCollectionPage.
+type apPage struct {
+	First        json.RawMessage `json:"first"`
+	Next         json.RawMessage `json:"next"`
+	OrderedItems []struct {
+		ID        string    `json:"id"`
+		Published time.Time `json:"published"`
+	} `json:"orderedItems"`
+}
+
+// apRef resolves a reference that is either a link or an embedded page.
+func apRef(ctx context.Context, raw json.RawMessage) (*apPage, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var u string
+	if err := json.Unmarshal(raw, &u); err == nil {
+		p := &apPage{}
+		if err := apGet(ctx, u, p); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	p := &apPage{}
+	if err := json.Unmarshal(raw, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// actorURL returns the actor URL of @user@instance via WebFinger.
+func actorURL(ctx context.Context, user string) (string, error) {
+	if strings.HasPrefix(user, "https://") || strings.HasPrefix(user, "http://") {
+		return user, nil
+	}
+	name, instance, err := parseAcct(user)
+	if err != nil {
+		return "", err
+	}
+	var wf struct {
+		Links []struct {
+			Rel  string `json:"rel"`
+			Type string `json:"type"`
+			Href string `json:"href"`
+		} `json:"links"`
+	}
+	v := url.Values{"resource": {"acct:" + name + "@" + instance}}
+	if err := getJSON(ctx, "https://"+instance+"/.well-known/webfinger?"+v.Encode(), "", &wf); err != nil {
+		return "", err
+	}
+	for _, l := range wf.Links {
+		if l.Rel == "self" && (strings.Contains(l.Type, "activity+json") || strings.Contains(l.Type, "ld+json")) {
+			return l.Href, nil
+		}
+	}
+	return "", fmt.Errorf("%s: no ActivityPub actor found", user)
+}
+
+func (a *activityPubSource) Fetch(ctx context.Context, user string, cached []Tweet) ([]Tweet, error) {
+	// https://www.w3.org/TR/activitypub/#outbox
+	// The outbox is paged from the most recent activity. Stop at the first page
+	// that is fully cached.
+	actor, err := actorURL(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	var act struct {
+		Outbox string `json:"outbox"`
+	}
+	if err := apGet(ctx, actor, &act); err != nil {
+		return nil, err
+	}
+	if len(act.Outbox) == 0 {
+		return nil, errors.New("actor has no outbox")
+	}
+	var outbox apPage
+	if err := apGet(ctx, act.Outbox, &outbox); err != nil {
+		return nil, err
+	}
+	known := make(map[int64]struct{}, len(cached))
+	for _, t := range cached {
+		known[t.Id] = struct{}{}
+	}
+	var out []Tweet
+	p, err := apRef(ctx, outbox.First)
+	for pages := 1; p != nil && err == nil && !enough(len(out)); pages++ {
+		slog.Debug("Retrieved activities", "count", len(p.OrderedItems))
+		added := 0
+		for _, item := range p.OrderedItems {
+			if item.Published.IsZero() {
+				continue
+			}
+			id := hashID(item.ID)
+			if _, ok := known[id]; !ok {
+				out = append(out, Tweet{CreatedAt: item.Published, Id: id})
+				added++
+			}
+		}
+		if added == 0 || pages == maxPages {
+			break
+		}
+		p, err = apRef(ctx, p.Next)
+	}
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
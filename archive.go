@@ -0,0 +1,256 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ChimeraCoder/anaconda"
+	"golang.org/x/exp/slog"
+)
+
+// archiveTweet is a tweet as found in data/tweets.js in the archive. The
+// archive has numbers as strings.
+type archiveTweet struct {
+	Tweet struct {
+		IDStr       string      `json:"id_str"`
+		CreatedAt   string      `json:"created_at"`
+		FullText    string      `json:"full_text"`
+		InReplyTo   string      `json:"in_reply_to_status_id_str"`
+		Source      string      `json:"source"`
+		Likes       json.Number `json:"favorite_count"`
+		Retweets    json.Number `json:"retweet_count"`
+		Coordinates *struct {
+			Type        string         `json:"type"`
+			Coordinates [2]json.Number `json:"coordinates"`
+		} `json:"coordinates"`
+		Entities struct {
+			Hashtags []struct {
+				Text string `json:"text"`
+			} `json:"hashtags"`
+			UserMentions []struct {
+				ScreenName string `json:"screen_name"`
+			} `json:"user_mentions"`
+			URLs []struct {
+				ExpandedURL string `json:"expanded_url"`
+			} `json:"urls"`
+		} `json:"entities"`
+		ExtendedEntities struct {
+			Media []struct{} `json:"media"`
+		} `json:"extended_entities"`
+		Place struct {
+			Name        string `json:"name"`
+			BoundingBox struct {
+				Coordinates [][][]json.Number `json:"coordinates"`
+			} `json:"bounding_box"`
+		} `json:"place"`
+	} `json:"tweet"`
+}
+
+// atoi returns n as an int, or 0 if invalid.
+func atoi(n json.Number) int {
+	i, _ := n.Int64()
+	return int(i)
+}
+
+// geo returns the location of the tweet, if any.
+func (a *archiveTweet) geo() *LatLong {
+	var c *anaconda.Coordinates
+	if p := a.Tweet.Coordinates; p != nil {
+		c = &anaconda.Coordinates{Type: p.Type}
+		c.Coordinates[0], _ = p.Coordinates[0].Float64()
+		c.Coordinates[1], _ = p.Coordinates[1].Float64()
+	}
+	var bbox [][][]float64
+	for _, ring := range a.Tweet.Place.BoundingBox.Coordinates {
+		var r [][]float64
+		for _, p := range ring {
+			if len(p) == 2 {
+				x, _ := p[0].Float64()
+				y, _ := p[1].Float64()
+				r = append(r, []float64{x, y})
+			}
+		}
+		bbox = append(bbox, r)
+	}
+	return tweetGeo(c, bbox)
+}
+
+// isArchiveTweets returns true if name is one of the files holding tweets in
+// an archive. Large archives are split in data/tweets-part1.js, etc and older
+// archives use data/tweet.js.
+func isArchiveTweets(name string) bool {
+	if path.Dir(name) != "data" {
+		return false
+	}
+	b := path.Base(name)
+	return b == "tweet.js" || b == "tweets.js" || (strings.HasPrefix(b, "tweets-part") && strings.HasSuffix(b, ".js"))
+}
+
+// parseArchiveTweets parses a data/tweets.js file, which is JSON prefixed with
+// a javascript assignment.
+func parseArchiveTweets(b []byte) ([]Tweet, error) {
+	i := bytes.IndexByte(b, '=')
+	if i == -1 {
+		return nil, errors.New("unexpected file format")
+	}
+	var items []archiveTweet
+	if err := json.Unmarshal(b[i+1:], &items); err != nil {
+		return nil, err
+	}
+	out := make([]Tweet, 0, len(items))
+	for _, item := range items {
+		id, err := strconv.ParseInt(item.Tweet.IDStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tweet id %q: %w", item.Tweet.IDStr, err)
+		}
+		t, err := time.Parse(time.RubyDate, item.Tweet.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("time: %w", err)
+		}
+		tw := Tweet{CreatedAt: t, Id: id, Place: item.Tweet.Place.Name, Text: item.Tweet.FullText, Source: clientName(item.Tweet.Source), Geo: item.geo(), Likes: atoi(item.Tweet.Likes), Retweets: atoi(item.Tweet.Retweets), Media: len(item.Tweet.ExtendedEntities.Media)}
+		// The archive doesn't tell which tweets are quotes and the retweets are
+		// only recognizable by their text.
+		tw.Kind = tweetKind(len(item.Tweet.InReplyTo) != 0, strings.HasPrefix(item.Tweet.FullText, "RT @"), false)
+		for _, h := range item.Tweet.Entities.Hashtags {
+			tw.Hashtags = append(tw.Hashtags, h.Text)
+		}
+		for _, m := range item.Tweet.Entities.UserMentions {
+			tw.Mentions = append(tw.Mentions, m.ScreenName)
+		}
+		for _, u := range item.Tweet.Entities.URLs {
+			tw.URLs = append(tw.URLs, u.ExpandedURL)
+		}
+		out = append(out, tw)
+	}
+	return out, nil
+}
+
+// archiveAccount is the account as found in data/account.js in the archive.
+type archiveAccount struct {
+	Account struct {
+		AccountID string `json:"accountId"`
+	} `json:"account"`
+}
+
+// parseArchiveAccount returns the user ID in a data/account.js file, which is
+// JSON prefixed with a javascript assignment.
+func parseArchiveAccount(b []byte) (string, error) {
+	i := bytes.IndexByte(b, '=')
+	if i == -1 {
+		return "", errors.New("unexpected file format")
+	}
+	var items []archiveAccount
+	if err := json.Unmarshal(b[i+1:], &items); err != nil {
+		return "", err
+	}
+	if len(items) == 0 {
+		return "", nil
+	}
+	return items[0].Account.AccountID, nil
+}
+
+// readArchive returns all the tweets in a Twitter archive zip file and the ID
+// of the user, if found.
+func readArchive(p string) ([]Tweet, string, error) {
+	r, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, "", err
+	}
+	defer r.Close()
+	var out []Tweet
+	id := ""
+	found := false
+	for _, f := range r.File {
+		if f.Name == "data/account.js" {
+			b, err := readZipFile(f)
+			if err != nil {
+				return nil, "", err
+			}
+			if id, err = parseArchiveAccount(b); err != nil {
+				return nil, "", fmt.Errorf("%s: %w", f.Name, err)
+			}
+			continue
+		}
+		if !isArchiveTweets(f.Name) {
+			continue
+		}
+		found = true
+		b, err := readZipFile(f)
+		if err != nil {
+			return nil, "", err
+		}
+		t, err := parseArchiveTweets(b)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", f.Name, err)
+		}
+		slog.Info("Read tweets", "count", len(t), "file", f.Name)
+		out = append(out, t...)
+	}
+	if !found {
+		return nil, "", errors.New("data/tweets.js not found; is it a twitter archive?")
+	}
+	return out, id, nil
+}
+
+// readZipFile returns the content of a file in a zip file.
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+func importArchive(args []string) error {
+	f := flag.NewFlagSet("import-archive", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "usage: restroom import-archive -u <user> <twitter-archive.zip>\n")
+		f.PrintDefaults()
+	}
+	user := f.String("u", "", "user to import the archive as")
+	registerStore(f)
+	logs := registerLog(f)
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+
+	if err := logs.apply(); err != nil {
+		return err
+	}
+	if f.NArg() != 1 {
+		return errors.New("expected exactly one archive")
+	}
+	if len(*user) == 0 {
+		return errors.New("-u is required")
+	}
+	tweets, id, err := readArchive(f.Arg(0))
+	if err != nil {
+		return err
+	}
+	c := load()
+	defer c.save()
+	// Store the tweets under the user ID like a fetch does, so they are
+	// reported together.
+	key := c.resolve(*user)
+	if len(id) != 0 {
+		key = "id:" + id
+		c.alias(*user, key)
+	}
+	n := c.merge(key, tweets)
+	fmt.Printf("Imported %d new tweets out of %d\n", n, len(tweets))
+	return nil
+}
@@ -0,0 +1,28 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import "testing"
+
+func TestParseArchiveAccount(t *testing.T) {
+	data := []struct {
+		in   string
+		want string
+	}{
+		{`window.YTD.account.part0 = [ { "account" : { "username" : "owl", "accountId" : "42" } } ]`, "42"},
+		{`window.YTD.account.part0 = []`, ""},
+	}
+	for i, l := range data {
+		got, err := parseArchiveAccount([]byte(l.in))
+		if err != nil || got != l.want {
+			t.Errorf("#%d: got %q, %v; want %q", i, got, err, l.want)
+		}
+	}
+	for i, in := range []string{`[]`, `window.YTD.account.part0 = {`} {
+		if got, err := parseArchiveAccount([]byte(in)); err == nil {
+			t.Errorf("#%d: got %q; want an error", i, got)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const bskyURL = "https://public.api.bsky.app/xrpc/"
+
+// tidAlphabet is the base32-sortable alphabet used by AT Protocol TIDs.
+const tidAlphabet = "234567abcdefghijklmnopqrstuvwxyz"
+
+// parseTID decodes an AT Protocol timestamp identifier, as used in record keys.
+func parseTID(s string) (int64, error) {
+	if len(s) != 13 {
+		return 0, fmt.Errorf("invalid TID %q", s)
+	}
+	var v int64
+	for i := 0; i < len(s); i++ {
+		d := strings.IndexByte(tidAlphabet, s[i])
+		if d < 0 || (i == 0 && d >= 16) {
+			return 0, fmt.Errorf("invalid TID %q", s)
+		}
+		v = v<<5 | int64(d)
+	}
+	return v, nil
+}
+
+type bskyFeed struct {
+	Cursor string `json:"cursor"`
+	Feed   []struct {
+		Post struct {
+			URI    string `json:"uri"`
+			Author struct {
+				DID string `json:"did"`
+			} `json:"author"`
+			Record struct {
+				CreatedAt time.Time `json:"createdAt"`
+				Reply     *struct{} `json:"reply"`
+				Embed     *struct {
+					Type string `json:"$type"`
+				} `json:"embed"`
+			} `json:"record"`
+			IndexedAt time.Time `json:"indexedAt"`
+		} `json:"post"`
+		Reason *struct {
+			Type string `json:"$type"`
+		} `json:"reason"`
+	} `json:"feed"`
+}
+
+func init() {
+	registerSource("bluesky", sourceDef{
+		new: func(cred *credentials) Source { return &blueskySource{} },
+	})
+}
+
+// blueskySource fetches the posts of a Bluesky account. No authentication is
+// needed.
+type blueskySource struct {
+	pager
+}
+
+func (b *blueskySource) Key(actor string) string {
+	return "bluesky:" + strings.TrimPrefix(actor, "@")
+}
+
+func (b *blueskySource) Fetch(ctx context.Context, actor string, cached []Tweet) ([]Tweet, error) {
+	// https://docs.bsky.app/docs/api/app-bsky-feed-get-author-feed
+	// - "limit" is limited to 100.
+	// - The cursor is the timestamp of the last post returned.
+	v := url.Values{
+		"actor":  {strings.TrimPrefix(actor, "@")},
+		"limit":  {strconv.Itoa(pageLen(100))},
+		"filter": {"posts_with_replies"},
+	}
+	var out []Tweet
+	var since time.Time
+	if first, ok := newest(cached); ok {
+		since = first.CreatedAt
+	}
+	if s, c, ok := strings.Cut(b.resume, ":"); ok {
+		// Resume the interrupted pass where it stopped.
+		if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+			since = time.UnixMilli(ms).UTC()
+			v.Set("cursor", c)
+		}
+	}
+	if !since.IsZero() {
+		// Pick up the posts since the last run first, from the most recent one
+		// until a cached one is reached.
+		var err error
+		if out, err = b.pages(ctx, v, since); err != nil {
+			return out, err
+		}
+		v.Del("cursor")
+	}
+	if last, ok := oldest(cached); ok {
+		m := last.CreatedAt.UTC().Format("2006-01-02T15:04:05.000Z")
+		slog.Debug("Using cursor", "cursor", m)
+		v.Set("cursor", m)
+	}
+	older, err := b.pages(ctx, v, time.Time{})
+	return append(out, older...), err
+}
+
+// pages returns up to 50 pages of the posts matching v. If since is set, it
+// stops at the posts older than since, the time of the most recent post
+// cached before the pass over the newer posts, to resume it if interrupted.
+func (b *blueskySource) pages(ctx context.Context, v url.Values, since time.Time) ([]Tweet, error) {
+	var out []Tweet
+	for i := 0; i < pageCount(50) && !enough(len(out)); i++ {
+		slog.Debug("Fetching")
+		var f bskyFeed
+		if err := getJSON(ctx, bskyURL+"app.bsky.feed.getAuthorFeed?"+v.Encode(), "", &f); err != nil {
+			// The transient errors were already retried.
+			return out, err
+		}
+		slog.Debug("Retrieved posts", "count", len(f.Feed))
+		n := len(out)
+		done := false
+		for _, item := range f.Feed {
+			if item.Reason != nil {
+				// Skip reposts, they only carry the original post's timestamp.
+				continue
+			}
+			id, err := parseTID(item.Post.URI[strings.LastIndexByte(item.Post.URI, '/')+1:])
+			if err != nil {
+				return out, err
+			}
+			// Use the same sort timestamp as the server does, as createdAt is set
+			// by the client and can be in the future.
+			t := item.Post.Record.CreatedAt
+			if t.IsZero() || t.After(item.Post.IndexedAt) {
+				t = item.Post.IndexedAt
+			}
+			if !since.IsZero() && t.Before(since) {
+				done = true
+				break
+			}
+			r := item.Post.Record
+			quote := r.Embed != nil && (r.Embed.Type == "app.bsky.embed.record" || r.Embed.Type == "app.bsky.embed.recordWithMedia")
+			out = append(out, Tweet{CreatedAt: t, Id: id, Kind: tweetKind(r.Reply != nil, false, quote)})
+		}
+		done = done || len(f.Cursor) == 0 || len(f.Feed) == 0
+		// Keep the cursor of an incomplete pass over the newer posts.
+		cursor := b.cursor
+		if !since.IsZero() {
+			cursor = ""
+			if !done {
+				cursor = strconv.FormatInt(since.UnixMilli(), 10) + ":" + f.Cursor
+			}
+		}
+		b.page(out[n:], cursor)
+		if done {
+			break
+		}
+		v.Set("cursor", f.Cursor)
+	}
+	return out, nil
+}
@@ -0,0 +1,251 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Top level buckets. Each key in "users" is a nested bucket of tweets keyed by
+// big endian ID, so they are iterated in ID order.
+var (
+	boltUsers     = []byte("users")
+	boltFetched   = []byte("fetched")
+	boltAliases   = []byte("aliases")
+	boltCursors   = []byte("cursors")
+	boltTimezones = []byte("timezones")
+)
+
+// boltStore is a Store in a bbolt database. The changes are done in a
+// transaction committed by Flush.
+type boltStore struct {
+	path string
+	db   *bolt.DB
+	tx   *bolt.Tx
+	// readOnly is set when the database was opened with readOnlyCache.
+	readOnly bool
+}
+
+// openBoltStore opens or creates a bbolt database. When the database doesn't
+// exist yet, the restroom.json next to it is imported into it.
+func openBoltStore(p string) (*boltStore, error) {
+	if readOnlyCache {
+		db, err := bolt.Open(p, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+		if err != nil {
+			return nil, err
+		}
+		return &boltStore{path: p, db: db, readOnly: true}, nil
+	}
+	_, err := os.Stat(p)
+	migrate := errors.Is(err, os.ErrNotExist)
+	db, err := bolt.Open(p, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateBolt(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &boltStore{path: p, db: db}
+	if migrate {
+		if err := importJSON(s, filepath.Join(filepath.Dir(p), "restroom.json")); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// txn returns the pending transaction, starting one if needed.
+func (s *boltStore) txn() (*bolt.Tx, error) {
+	if s.tx == nil {
+		tx, err := s.db.Begin(!s.readOnly)
+		if err != nil {
+			return nil, err
+		}
+		s.tx = tx
+	}
+	return s.tx, nil
+}
+
+func (s *boltStore) Users() ([]string, error) {
+	tx, err := s.txn()
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	err = tx.Bucket(boltUsers).ForEach(func(k, _ []byte) error {
+		out = append(out, string(k))
+		return nil
+	})
+	return out, err
+}
+
+func (s *boltStore) LoadUser(key string) ([]Tweet, error) {
+	tx, err := s.txn()
+	if err != nil {
+		return nil, err
+	}
+	b := tx.Bucket(boltUsers).Bucket([]byte(key))
+	if b == nil {
+		return nil, nil
+	}
+	out := make([]Tweet, 0, b.Stats().KeyN)
+	err = b.ForEach(func(_, v []byte) error {
+		var t Tweet
+		err := json.Unmarshal(v, &t)
+		out = append(out, t)
+		return err
+	})
+	sortTweets(out)
+	return out, err
+}
+
+func (s *boltStore) AppendTweets(key string, tweets []Tweet) error {
+	tx, err := s.txn()
+	if err != nil {
+		return err
+	}
+	b, err := tx.Bucket(boltUsers).CreateBucketIfNotExists([]byte(key))
+	if err != nil {
+		return err
+	}
+	var id [8]byte
+	for _, t := range tweets {
+		v, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		binary.BigEndian.PutUint64(id[:], uint64(t.Id))
+		if err := b.Put(id[:], v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *boltStore) RemoveUser(key string) error {
+	tx, err := s.txn()
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltUsers).DeleteBucket([]byte(key)); err != nil && err != bolt.ErrBucketNotFound {
+		return err
+	}
+	return nil
+}
+
+func (s *boltStore) Meta() (*cacheMeta, error) {
+	tx, err := s.txn()
+	if err != nil {
+		return nil, err
+	}
+	m := newCacheMeta()
+	err = tx.Bucket(boltFetched).ForEach(func(k, v []byte) error {
+		t, err := time.Parse(time.RFC3339Nano, string(v))
+		m.Fetched[string(k)] = t
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Bucket(boltAliases).ForEach(func(k, v []byte) error {
+		m.Aliases[string(k)] = string(v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Bucket(boltCursors).ForEach(func(k, v []byte) error {
+		m.Cursors[string(k)] = string(v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Bucket(boltTimezones).ForEach(func(k, v []byte) error {
+		m.Timezones[string(k)] = string(v)
+		return nil
+	})
+	return m, err
+}
+
+func (s *boltStore) SetMeta(m *cacheMeta) error {
+	tx, err := s.txn()
+	if err != nil {
+		return err
+	}
+	// These are small so they are rewritten.
+	for _, n := range [][]byte{boltFetched, boltAliases, boltCursors, boltTimezones} {
+		if err := tx.DeleteBucket(n); err != nil {
+			return err
+		}
+	}
+	fetched, err := tx.CreateBucket(boltFetched)
+	if err != nil {
+		return err
+	}
+	for k, t := range m.Fetched {
+		if err := fetched.Put([]byte(k), []byte(t.Format(time.RFC3339Nano))); err != nil {
+			return err
+		}
+	}
+	for _, b := range []struct {
+		name []byte
+		m    map[string]string
+	}{{boltAliases, m.Aliases}, {boltCursors, m.Cursors}, {boltTimezones, m.Timezones}} {
+		bucket, err := tx.CreateBucket(b.name)
+		if err != nil {
+			return err
+		}
+		for k, v := range b.m {
+			if err := bucket.Put([]byte(k), []byte(v)); err != nil {
+				return err
+			}
+		}
+	}
+	// Next to the version of the format, for provenance.
+	return tx.Bucket([]byte("meta")).Put([]byte("restroom"), []byte(version()))
+}
+
+func (s *boltStore) Flush() error {
+	if s.tx == nil {
+		return nil
+	}
+	err := s.tx.Commit()
+	s.tx = nil
+	return err
+}
+
+// Compact implements compacter by copying the database into a new file.
+func (s *boltStore) Compact() error {
+	tmp := s.path + ".tmp"
+	dst, err := bolt.Open(tmp, 0600, nil)
+	if err != nil {
+		return err
+	}
+	if err := bolt.Compact(dst, s.db, 1<<20); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := s.db.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.db, err = bolt.Open(s.path, 0600, &bolt.Options{Timeout: time.Second})
+	return err
+}
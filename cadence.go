@@ -0,0 +1,176 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// cadence is how regularly a user tweets.
+type cadence struct {
+	// LongestStreak is the most consecutive days with tweets, starting on
+	// StreakFrom.
+	LongestStreak int
+	StreakFrom    string
+	// LongestDrought is the most consecutive days without tweets between the
+	// first tweet and the last one, starting on DroughtFrom.
+	LongestDrought int    `json:",omitempty"`
+	DroughtFrom    string `json:",omitempty"`
+	// PerDay is the average number of tweets per day from the first tweet to
+	// the last one.
+	PerDay float64
+	// MedianInterval is the median time between two consecutive tweets, in
+	// seconds.
+	MedianInterval float64 `json:",omitempty"`
+}
+
+// computeCadence returns the cadence of the tweets posted at times, which
+// are in the timezone to report in. It returns nil without tweets.
+func computeCadence(times []time.Time) *cadence {
+	if len(times) == 0 {
+		return nil
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	// Use the dates at midnight UTC so the days are all 24h long.
+	day := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	c := &cadence{LongestStreak: 1, StreakFrom: times[0].Format("2006-01-02")}
+	start, prev := day(times[0]), day(times[0])
+	for _, t := range times[1:] {
+		d := day(t)
+		switch gap := int(d.Sub(prev) / (24 * time.Hour)); {
+		case gap == 0:
+			continue
+		case gap == 1:
+			if n := int(d.Sub(start)/(24*time.Hour)) + 1; n > c.LongestStreak {
+				c.LongestStreak, c.StreakFrom = n, start.Format("2006-01-02")
+			}
+		default:
+			if gap-1 > c.LongestDrought {
+				c.LongestDrought, c.DroughtFrom = gap-1, prev.AddDate(0, 0, 1).Format("2006-01-02")
+			}
+			start = d
+		}
+		prev = d
+	}
+	days := int(day(times[len(times)-1]).Sub(day(times[0]))/(24*time.Hour)) + 1
+	c.PerDay = float64(len(times)) / float64(days)
+	if len(times) > 1 {
+		intervals := make([]time.Duration, len(times)-1)
+		for i := range intervals {
+			intervals[i] = times[i+1].Sub(times[i])
+		}
+		sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+		m := intervals[len(intervals)/2]
+		if len(intervals)%2 == 0 {
+			m = (intervals[len(intervals)/2-1] + m) / 2
+		}
+		c.MedianInterval = m.Seconds()
+	}
+	return c
+}
+
+// medianInterval returns the median time between two tweets.
+func (c *cadence) medianInterval() time.Duration {
+	return time.Duration(c.MedianInterval * float64(time.Second))
+}
+
+// String returns the cadence as a line of text.
+func (c *cadence) String() string {
+	s := fmt.Sprintf("longest streak: %s from %s", days(c.LongestStreak), c.StreakFrom)
+	if c.LongestDrought != 0 {
+		s += fmt.Sprintf(", longest drought: %s from %s", days(c.LongestDrought), c.DroughtFrom)
+	}
+	s += ", " + formatRate(c.PerDay) + " tweets per day"
+	if c.MedianInterval != 0 {
+		s += ", median interval: " + formatInterval(c.medianInterval())
+	}
+	return s
+}
+
+// days returns n days in English.
+func days(n int) string {
+	if n == 1 {
+		return "1 day"
+	}
+	return strconv.Itoa(n) + " days"
+}
+
+// formatRate returns f with one decimal, or two significant digits when it
+// is less than 1, e.g. 0.0082.
+func formatRate(f float64) string {
+	if f < 1 {
+		return strconv.FormatFloat(f, 'g', 2, 64)
+	}
+	return strconv.FormatFloat(f, 'f', 1, 64)
+}
+
+// formatInterval returns d rounded for humans, e.g. 3h05m or 2.5 days.
+func formatInterval(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%.1f days", d.Hours()/24)
+}
+
+// gap is a period without tweets.
+type gap struct {
+	// From and To are the times of the tweets before and after the gap.
+	From time.Time
+	To   time.Time
+	// Wall is set when the tweets after the gap are about the 3,200 most recent
+	// ones the Twitter API returns, so the gap is likely the older tweets that
+	// could not be fetched.
+	Wall bool `json:",omitempty"`
+}
+
+// cappedSources are the sources whose timelines only return the 3,200 most
+// recent tweets.
+var cappedSources = map[string]bool{"twitter": true, "twitter2": true}
+
+// largestGaps returns the n largest gaps between the tweets posted at times,
+// the largest first. capped is set when the tweets were fetched from a source
+// in cappedSources, to tell the gaps likely due to the limit.
+func largestGaps(times []time.Time, n int, capped bool) []gap {
+	if n == 0 || len(times) < 2 {
+		return nil
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	out := make([]gap, 0, len(times)-1)
+	for i := 1; i < len(times); i++ {
+		newer := len(times) - i
+		out = append(out, gap{From: times[i-1], To: times[i], Wall: capped && newer >= 3000 && newer <= 3200})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].duration() > out[j].duration() })
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+func (g *gap) duration() time.Duration {
+	return g.To.Sub(g.From)
+}
+
+func (g gap) String() string {
+	f := "2006-01-02"
+	if g.duration() < 48*time.Hour {
+		f = "2006-01-02 15:04"
+	}
+	s := fmt.Sprintf("%s to %s: %s", g.From.Format(f), g.To.Format(f), formatInterval(g.duration()))
+	if g.Wall {
+		s += " (the 3,200 most recent tweets start after it; import the archive for the older ones)"
+	}
+	return s
+}
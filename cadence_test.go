@@ -0,0 +1,102 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestComputeCadence(t *testing.T) {
+	d := func(day, hour int) time.Time {
+		return time.Date(2020, 1, day, hour, 0, 0, 0, time.UTC)
+	}
+	data := []struct {
+		times []time.Time
+		want  *cadence
+	}{
+		{nil, nil},
+		{
+			[]time.Time{d(1, 12)},
+			&cadence{LongestStreak: 1, StreakFrom: "2020-01-01", PerDay: 1},
+		},
+		{
+			// Out of order, with a streak of 3 days and a drought of 4.
+			[]time.Time{d(3, 10), d(1, 10), d(2, 10), d(2, 12), d(8, 10)},
+			&cadence{LongestStreak: 3, StreakFrom: "2020-01-01", LongestDrought: 4, DroughtFrom: "2020-01-04", PerDay: 5. / 8, MedianInterval: (23 * time.Hour).Seconds()},
+		},
+	}
+	for i, l := range data {
+		if got := computeCadence(l.times); !reflect.DeepEqual(got, l.want) {
+			t.Errorf("#%d: got %+v; want %+v", i, got, l.want)
+		}
+	}
+}
+
+func TestLargestGaps(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	// 3,100 tweets an hour apart, preceded by one posted 30 days earlier.
+	times := []time.Time{start}
+	for i := 0; i < 3100; i++ {
+		times = append(times, start.Add(30*24*time.Hour+time.Duration(i)*time.Hour))
+	}
+	data := []struct {
+		times  []time.Time
+		n      int
+		capped bool
+		want   []gap
+	}{
+		{nil, 3, true, nil},
+		{times[:1], 3, true, nil},
+		{times, 0, true, nil},
+		{
+			times[:3], 3, false,
+			[]gap{{From: times[0], To: times[1]}, {From: times[1], To: times[2]}},
+		},
+		{
+			times[:3], 1, false,
+			[]gap{{From: times[0], To: times[1]}},
+		},
+		{
+			times, 1, true,
+			[]gap{{From: times[0], To: times[1], Wall: true}},
+		},
+		{
+			// Only the Twitter sources have the 3,200 tweets limit.
+			times, 1, false,
+			[]gap{{From: times[0], To: times[1]}},
+		},
+		{
+			// Too few tweets after the gap for the limit.
+			times[:100], 1, true,
+			[]gap{{From: times[0], To: times[1]}},
+		},
+	}
+	for i, l := range data {
+		in := append([]time.Time(nil), l.times...)
+		if got := largestGaps(in, l.n, l.capped); !reflect.DeepEqual(got, l.want) {
+			t.Errorf("#%d: got %v; want %v", i, got, l.want)
+		}
+	}
+}
+
+func TestFormatInterval(t *testing.T) {
+	data := []struct {
+		d    time.Duration
+		want string
+	}{
+		{42 * time.Second, "42s"},
+		{5*time.Minute + 10*time.Second, "5m"},
+		{3*time.Hour + 5*time.Minute, "3h05m"},
+		{47 * time.Hour, "47h00m"},
+		{60 * time.Hour, "2.5 days"},
+	}
+	for i, l := range data {
+		if got := formatInterval(l.d); got != l.want {
+			t.Errorf("#%d: formatInterval(%s) = %q; want %q", i, l.d, got, l.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// chronotype is when the user likely sleeps, inferred from the tweets per
+// hour.
+type chronotype struct {
+	// SleepFrom is the first hour of the longest span of quiet hours and
+	// SleepHours its length.
+	SleepFrom  int
+	SleepHours int
+	// Label is "early bird", "intermediate" or "night owl", from the middle of
+	// the sleep window.
+	Label string
+	// Confidence is from 0 to 1; it grows with the number of tweets and how
+	// quiet the sleep window is compared to the other hours.
+	Confidence float64
+}
+
+// computeChronotype returns the chronotype from the tweets per hour, or nil
+// if there isn't a span of at least 3 quiet hours.
+func computeChronotype(hours [24]int) *chronotype {
+	total := 0
+	for _, n := range hours {
+		total += n
+	}
+	if total == 0 {
+		return nil
+	}
+	// An hour is quiet when it has less than a quarter of the average.
+	quiet := func(h int) bool { return float64(hours[h%24]) <= float64(total)/24/4 }
+	from, length := 0, 0
+	for h := 0; h < 24; h++ {
+		if !quiet(h) || quiet(h+23) {
+			// Only start at the beginning of a span.
+			continue
+		}
+		n := 0
+		for n < 24 && quiet(h+n) {
+			n++
+		}
+		if n > length {
+			from, length = h, n
+		}
+	}
+	if length < 3 || length == 24 {
+		return nil
+	}
+	c := &chronotype{SleepFrom: from, SleepHours: length}
+	// The middle of the sleep averages 4:00; see the Munich ChronoType
+	// Questionnaire. Sleeping in the evening is early, in the day is late.
+	mid := math.Mod(float64(from)+float64(length)/2, 24)
+	if mid >= 18 {
+		mid -= 24
+	}
+	switch {
+	case mid < 3.5:
+		c.Label = "early bird"
+	case mid > 5:
+		c.Label = "night owl"
+	default:
+		c.Label = "intermediate"
+	}
+	asleep := 0
+	for h := from; h < from+length; h++ {
+		asleep += hours[h%24]
+	}
+	expected := float64(total) * float64(length) / 24
+	c.Confidence = (1 - float64(asleep)/expected) * (1 - math.Exp(-float64(total)/200))
+	return c
+}
+
+// sleepTo returns the hour following the sleep window.
+func (c *chronotype) sleepTo() int {
+	return (c.SleepFrom + c.SleepHours) % 24
+}
+
+// confidence returns the confidence in words.
+func (c *chronotype) confidence() string {
+	switch {
+	case c.Confidence >= 0.7:
+		return "high"
+	case c.Confidence >= 0.4:
+		return "medium"
+	}
+	return "low"
+}
+
+func (c *chronotype) String() string {
+	return fmt.Sprintf("%s, likely asleep from %s to %s (%s confidence, %.2f)", c.Label, clockLabel(c.SleepFrom), clockLabel(c.sleepTo()), c.confidence(), c.Confidence)
+}
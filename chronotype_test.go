@@ -0,0 +1,67 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import "testing"
+
+func TestComputeChronotype(t *testing.T) {
+	// quietHours returns 100 tweets per hour except from the hour from for n
+	// hours.
+	quietHours := func(from, n int) [24]int {
+		var h [24]int
+		for i := range h {
+			h[i] = 100
+		}
+		for i := from; i < from+n; i++ {
+			h[i%24] = 0
+		}
+		return h
+	}
+	data := []struct {
+		hours [24]int
+		from  int
+		len   int
+		label string
+	}{
+		{quietHours(0, 7), 0, 7, "intermediate"},
+		{quietHours(22, 7), 22, 7, "early bird"},
+		{quietHours(2, 8), 2, 8, "night owl"},
+		// The longest span wins.
+		{func() [24]int { h := quietHours(1, 6); h[12], h[13] = 0, 0; return h }(), 1, 6, "intermediate"},
+	}
+	for i, l := range data {
+		c := computeChronotype(l.hours)
+		if c == nil {
+			t.Errorf("#%d: got nil", i)
+			continue
+		}
+		if c.SleepFrom != l.from || c.SleepHours != l.len || c.Label != l.label {
+			t.Errorf("#%d: got %+v; want from %d for %d hours, %s", i, c, l.from, l.len, l.label)
+		}
+		if c.Confidence <= 0 || c.Confidence > 1 {
+			t.Errorf("#%d: confidence %f", i, c.Confidence)
+		}
+	}
+}
+
+func TestComputeChronotypeNone(t *testing.T) {
+	var flat [24]int
+	for i := range flat {
+		flat[i] = 10
+	}
+	short := flat
+	short[3], short[4] = 0, 0
+	var single [24]int
+	single[12] = 10
+	for i, h := range [][24]int{{}, flat, short} {
+		if c := computeChronotype(h); c != nil {
+			t.Errorf("#%d: got %+v", i, c)
+		}
+	}
+	// A lone busy hour means 23 quiet hours.
+	if c := computeChronotype(single); c == nil || c.SleepFrom != 13 || c.SleepHours != 23 {
+		t.Errorf("got %+v", c)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// noColor is set with -no-color.
+var noColor bool
+
+// ANSI attributes of the output.
+const (
+	colorPeak  = "1;32"
+	colorDim   = "2"
+	colorWarn  = "33"
+	colorError = "1;31"
+)
+
+// registerColor registers -no-color on f.
+func registerColor(f *flag.FlagSet) {
+	f.BoolVar(&noColor, "no-color", false, "don't color the output; $NO_COLOR also disables it")
+}
+
+// useColor returns true when w is a terminal and the colors weren't disabled,
+// see https://no-color.org.
+func useColor(w io.Writer) bool {
+	if noColor || len(os.Getenv("NO_COLOR")) != 0 {
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// paint returns s with the ANSI attributes code when on is set.
+func paint(s, code string, on bool) string {
+	if !on || len(s) == 0 {
+		return s
+	}
+	return "\033[" + code + "m" + s + "\033[0m"
+}
+
+// warnf prints a warning to stderr.
+func warnf(format string, a ...interface{}) {
+	fetchProgress.clear()
+	fmt.Fprintln(os.Stderr, paint(fmt.Sprintf("restroom: "+format+".", a...), colorWarn, useColor(os.Stderr)))
+}
@@ -0,0 +1,183 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// completionScripts call "restroom completion __complete" with the words of
+// the command line up to the one being completed.
+var completionScripts = map[string]string{
+	"bash": `_restroom() {
+	local IFS=$'\n'
+	COMPREPLY=($(restroom completion __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null </dev/null))
+}
+complete -o default -F _restroom restroom
+`,
+	"fish": `function __restroom_complete
+	set -l words (commandline -opc)
+	set -e words[1]
+	restroom completion __complete $words (commandline -ct) 2>/dev/null </dev/null
+end
+complete -c restroom -a '(__restroom_complete)'
+`,
+	"zsh": `#compdef restroom
+_restroom() {
+	local -a c
+	c=(${(f)"$(restroom completion __complete "${(@)words[2,CURRENT]}" 2>/dev/null </dev/null)"})
+	if (( ${#c} )); then
+		compadd -Q -- $c
+	else
+		_files
+	fi
+}
+compdef _restroom restroom
+`,
+}
+
+// completionArgs are the arguments accepted right after a command.
+var completionArgs = map[string][]string{
+	"cache":      {"info"},
+	"completion": {"bash", "fish", "zsh"},
+	"export":     {"csv", "json"},
+	"users":      {"rm"},
+}
+
+// completionCmd prints the completion script of a shell.
+func completionCmd(args []string) error {
+	if len(args) != 0 && args[0] == "__complete" {
+		return complete(args[1:])
+	}
+	f := flag.NewFlagSet("completion", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "usage: restroom completion bash|zsh|fish\n\n")
+		fmt.Fprintf(f.Output(), "e.g. add to ~/.bashrc:\n  source <(restroom completion bash)\n")
+		f.PrintDefaults()
+	}
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+	if f.NArg() != 1 {
+		return errors.New("expected a shell: bash, zsh or fish")
+	}
+	s, ok := completionScripts[f.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q; use bash, zsh or fish", f.Arg(0))
+	}
+	fmt.Print(s)
+	return nil
+}
+
+// complete prints the candidates for the last word of the command line words,
+// one per line.
+func complete(words []string) error {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur, before := words[len(words)-1], words[:len(words)-1]
+	prefix := ""
+	var l []string
+	switch {
+	case len(before) != 0 && before[len(before)-1] == "-u":
+		// -u accepts a comma separated list.
+		if i := strings.LastIndexByte(cur, ','); i != -1 {
+			prefix, cur = cur[:i+1], cur[i+1:]
+		}
+		l = cachedUsers(before)
+	case len(before) != 0 && before[len(before)-1] == "-store":
+		for n := range stores {
+			l = append(l, n)
+		}
+	case strings.HasPrefix(cur, "-"):
+		l = commandFlags(before)
+	case len(before) == 0:
+		for n := range subcommands {
+			l = append(l, n)
+		}
+	case len(before) == 1 && before[0] == "help":
+		l = append(l, "config")
+		for n := range subcommands {
+			l = append(l, n)
+		}
+	case len(before) == 1:
+		l = completionArgs[before[0]]
+	}
+	sort.Strings(l)
+	for _, c := range l {
+		if strings.HasPrefix(c, cur) {
+			fmt.Println(prefix + c)
+		}
+	}
+	return nil
+}
+
+// listFlags is set while completing to be called by parseFlags instead of
+// parsing the flags.
+var listFlags func(f *flag.FlagSet)
+
+// errFlagsListed is returned by parseFlags when listFlags is set.
+var errFlagsListed = errors.New("flags listed")
+
+// commandFlags returns the flags of the command in args, by running it until
+// it parses its flags.
+func commandFlags(args []string) []string {
+	run := fetchAndReport
+	if len(args) != 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, ok := subcommands[args[0]]
+		if !ok || args[0] == "help" {
+			return nil
+		}
+		run, args = cmd.run, args[1:]
+	}
+	var out []string
+	listFlags = func(f *flag.FlagSet) {
+		f.VisitAll(func(fl *flag.Flag) { out = append(out, "-"+fl.Name) })
+	}
+	defer func() { listFlags = nil }()
+	run(args)
+	return out
+}
+
+// cachedUsers returns the keys and the names of the users in the cache
+// selected with -store and -cache in words or the configuration file. The
+// cache is opened read-only.
+func cachedUsers(words []string) []string {
+	var args []string
+	for i, w := range words {
+		n, _, ok := strings.Cut(strings.TrimLeft(w, "-"), "=")
+		if !strings.HasPrefix(w, "-") || (n != "store" && n != "cache") {
+			continue
+		}
+		args = append(args, w)
+		if !ok && i+1 < len(words) {
+			args = append(args, words[i+1])
+		}
+	}
+	f := flag.NewFlagSet("completion", flag.ContinueOnError)
+	registerStore(f)
+	if parseFlags(f, args) != nil {
+		return nil
+	}
+	readOnlyCache = true
+	s, err := openStore()
+	if err != nil {
+		return nil
+	}
+	keys, err := s.Users()
+	if err != nil {
+		return nil
+	}
+	if m, err := s.Meta(); err == nil {
+		for k := range m.Aliases {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,46 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCachedUsers(t *testing.T) {
+	defer func(s, p string) { cacheStore, cachePath, readOnlyCache = s, p, false }(cacheStore, cachePath)
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("XDG_DATA_HOME", dir)
+	// An old version, which is not upgraded.
+	b := []byte(`{"Users":{"alice":[{"CreatedAt":"2017-03-04T05:06:07Z","Id":1,"Place":""}]},"Aliases":{"al":"alice"}}`)
+	p := filepath.Join(dir, "c.json")
+	if err := ioutil.WriteFile(p, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	got := cachedUsers([]string{"fetch", "-store", "json", "-cache=" + p, "-u"})
+	sort.Strings(got)
+	if want := []string{"al", "alice"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q; want %q", got, want)
+	}
+	if c, err := ioutil.ReadFile(p); err != nil || !bytes.Equal(c, b) {
+		t.Fatalf("the cache was modified: %v", err)
+	}
+	if _, err := os.Stat(p + ".lock"); err == nil {
+		t.Fatal("the cache was locked")
+	}
+	// The default cache doesn't exist and is not created.
+	if got := cachedUsers([]string{"-store", "sqlite", "-u"}); len(got) != 0 {
+		t.Fatalf("got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "restroom", "restroom.db")); err == nil {
+		t.Fatal("the cache was created")
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+// configPath returns the path to the configuration file in the user's
+// configuration directory.
+func configPath() (string, error) {
+	d, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, "restroom", "config.toml"), nil
+}
+
+// loadConfig returns the content of the configuration file, which is empty if
+// the file doesn't exist.
+func loadConfig() (string, map[string]interface{}, error) {
+	cfg := map[string]interface{}{}
+	p, err := configPath()
+	if err != nil {
+		return "", cfg, err
+	}
+	if _, err := toml.DecodeFile(p, &cfg); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return p, cfg, nil
+		}
+		return p, cfg, fmt.Errorf("%s: %w", p, err)
+	}
+	return p, cfg, nil
+}
+
+// targetFlags are exclusive, so none is taken from the configuration file when
+// one is specified.
+var targetFlags = []string{"u", "q", "list", "users-file"}
+
+// parseFlags parses args, then sets the flags not specified from the
+// configuration file.
+//
+// The top-level keys of the file are the default flag values of every command
+// having a flag of that name; a table named after a command, e.g. [fetch] or
+// ["cache info"], applies only to it and takes precedence. An array sets a
+// flag once per item.
+func parseFlags(f *flag.FlagSet, args []string) error {
+	if listFlags != nil {
+		listFlags(f)
+		return errFlagsListed
+	}
+	f.Parse(args)
+	p, cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	f.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+	for _, n := range targetFlags {
+		if set[n] {
+			for _, n := range targetFlags {
+				set[n] = true
+			}
+			break
+		}
+	}
+	values := map[string]interface{}{}
+	for k, v := range cfg {
+		if _, ok := v.(map[string]interface{}); !ok && f.Lookup(k) != nil {
+			values[k] = v
+		}
+	}
+	tables := []string{f.Name()}
+	if f.Name() == "restroom" {
+		// Without a command, restroom fetches then prints the stats.
+		tables = []string{"fetch", "stats"}
+	}
+	for _, n := range tables {
+		t, _ := cfg[n].(map[string]interface{})
+		for k, v := range t {
+			if f.Lookup(k) == nil {
+				return fmt.Errorf("%s: [%s] %s: no such flag", p, n, k)
+			}
+			values[k] = v
+		}
+	}
+	for k, v := range values {
+		if set[k] {
+			continue
+		}
+		items, ok := v.([]interface{})
+		if !ok {
+			items = []interface{}{v}
+		}
+		for _, i := range items {
+			if err := f.Set(k, fmt.Sprint(i)); err != nil {
+				return fmt.Errorf("%s: %s: %w", p, k, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configExample is printed by "restroom help config".
+const configExample = `# Flags of every command.
+source = "mastodon"
+store = "sqlite"
+u = "@alice@example.com"
+
+# Flags of a single command.
+[fetch]
+workers = 4
+wait = true
+`
+
+// configHelp describes the configuration file.
+func configHelp() {
+	p, err := configPath()
+	if err != nil {
+		p = "config.toml"
+	}
+	fmt.Fprintf(os.Stderr, "The flags not specified are read from %s, e.g.:\n\n%s", p, configExample)
+}
@@ -0,0 +1,406 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ChimeraCoder/anaconda"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/exp/slog"
+)
+
+// credentialsFile is the format of credentials.toml.
+//
+// The top level tokens are the default profile; named profiles are stored in
+// [profiles.<name>] tables and share the consumer key unless overridden. When
+// Keyring is set, the secrets of the section are in the OS keyring instead.
+type credentialsFile struct {
+	Keyring        bool   `toml:"keyring,omitempty"`
+	ConsumerKey    string `toml:"consumer_key,omitempty"`
+	ConsumerSecret string `toml:"consumer_secret,omitempty"`
+	Token          string `toml:"token,omitempty"`
+	TokenSecret    string `toml:"token_secret,omitempty"`
+	Bearer         string `toml:"bearer,omitempty"`
+	// OAuth 2.0 user context for the API v2, see oauth2.go.
+	ClientID     string                      `toml:"client_id,omitempty"`
+	OAuth2Token  string                      `toml:"oauth2_token,omitempty"`
+	RefreshToken string                      `toml:"oauth2_refresh_token,omitempty"`
+	OAuth2Expiry time.Time                   `toml:"oauth2_expiry,omitempty"`
+	OAuth2Scope  string                      `toml:"oauth2_scope,omitempty"`
+	Profiles     map[string]*credentialsFile `toml:"profiles,omitempty"`
+}
+
+// profile returns the credentials of the named profile, the default one if
+// name is empty.
+func (cf *credentialsFile) profile(name string) (*credentialsFile, error) {
+	top := *cf
+	top.Profiles = nil
+	if err := top.unlock(""); err != nil {
+		return nil, err
+	}
+	if len(name) == 0 {
+		return &top, nil
+	}
+	p, ok := cf.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown credentials profile %q", name)
+	}
+	out := *p
+	if err := out.unlock(name); err != nil {
+		return nil, err
+	}
+	if len(out.ConsumerKey) == 0 && len(out.ConsumerSecret) == 0 {
+		out.ConsumerKey = top.ConsumerKey
+		out.ConsumerSecret = top.ConsumerSecret
+	}
+	return &out, nil
+}
+
+// keyringAccount returns the keyring entry name of a profile.
+func keyringAccount(profile string) string {
+	if len(profile) == 0 {
+		return "default"
+	}
+	return profile
+}
+
+// unlock fills the secrets of the section from the OS keyring, if stored
+// there.
+func (cf *credentialsFile) unlock(profile string) error {
+	if !cf.Keyring {
+		return nil
+	}
+	s, err := keyring.Get("restroom", keyringAccount(profile))
+	if err != nil {
+		return fmt.Errorf("keyring: %w", err)
+	}
+	k := credentialsFile{}
+	if _, err := toml.Decode(s, &k); err != nil {
+		return fmt.Errorf("keyring: %w", err)
+	}
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&cf.ConsumerKey, k.ConsumerKey},
+		{&cf.ConsumerSecret, k.ConsumerSecret},
+		{&cf.Token, k.Token},
+		{&cf.TokenSecret, k.TokenSecret},
+		{&cf.Bearer, k.Bearer},
+		{&cf.OAuth2Token, k.OAuth2Token},
+		{&cf.RefreshToken, k.RefreshToken},
+	} {
+		if len(*f.dst) == 0 {
+			*f.dst = f.src
+		}
+	}
+	return nil
+}
+
+// lock moves the secrets of the section to the OS keyring.
+func (cf *credentialsFile) lock(profile string) error {
+	k := credentialsFile{
+		ConsumerKey:    cf.ConsumerKey,
+		ConsumerSecret: cf.ConsumerSecret,
+		Token:          cf.Token,
+		TokenSecret:    cf.TokenSecret,
+		Bearer:         cf.Bearer,
+		OAuth2Token:    cf.OAuth2Token,
+		RefreshToken:   cf.RefreshToken,
+	}
+	var b bytes.Buffer
+	if err := toml.NewEncoder(&b).Encode(&k); err != nil {
+		return err
+	}
+	if err := keyring.Set("restroom", keyringAccount(profile), b.String()); err != nil {
+		return fmt.Errorf("keyring: %w", err)
+	}
+	*cf = credentialsFile{
+		Keyring:      true,
+		ClientID:     cf.ClientID,
+		OAuth2Expiry: cf.OAuth2Expiry,
+		OAuth2Scope:  cf.OAuth2Scope,
+		Profiles:     cf.Profiles,
+	}
+	return nil
+}
+
+// credentialsPath returns the path to the credentials file in the user's
+// configuration directory.
+func credentialsPath() (string, error) {
+	d, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, "restroom", "credentials.toml"), nil
+}
+
+// loadCredentialsFile returns the content of the credentials file, which is
+// empty if the file doesn't exist.
+//
+// The file is refused if it is readable by other users.
+func loadCredentialsFile() (*credentialsFile, error) {
+	cf := &credentialsFile{}
+	p, err := credentialsPath()
+	if err != nil {
+		return cf, err
+	}
+	fi, err := os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return cf, nil
+	}
+	if err != nil {
+		return cf, err
+	}
+	// Windows doesn't have unix permissions.
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0077 != 0 {
+		return cf, fmt.Errorf("%s: permissions %#o are too open; run chmod 600 %s", p, fi.Mode().Perm(), p)
+	}
+	if _, err := toml.DecodeFile(p, cf); err != nil {
+		return cf, fmt.Errorf("%s: %w", p, err)
+	}
+	return cf, nil
+}
+
+func (cf *credentialsFile) save() (string, error) {
+	p, err := credentialsPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := toml.NewEncoder(&b).Encode(cf); err != nil {
+		return "", err
+	}
+	return p, ioutil.WriteFile(p, b.Bytes(), 0600)
+}
+
+// loadDefaults fills the credentials not specified as flags from the
+// environment, then from the credentials file.
+//
+// A flag value "@path" and the variables $RESTROOM_<NAME>_FILE are read from
+// a file.
+func (c *credentials) loadDefaults() error {
+	if len(c.Profile) == 0 {
+		c.Profile = os.Getenv("RESTROOM_PROFILE")
+	}
+	all, err := loadCredentialsFile()
+	if err != nil {
+		return err
+	}
+	cf, err := all.profile(c.Profile)
+	if err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		name string
+		dst  *string
+		file string
+	}{
+		{"consumer_key", &c.ConsumerKey, cf.ConsumerKey},
+		{"consumer_secret", &c.ConsumerSecret, cf.ConsumerSecret},
+		{"token", &c.Token, cf.Token},
+		{"token_secret", &c.TokenSecret, cf.TokenSecret},
+		{"bearer", &c.Bearer, cf.Bearer},
+	} {
+		origin := "flag"
+		if strings.HasPrefix(*f.dst, "@") {
+			origin = (*f.dst)[1:]
+			if *f.dst, err = readSecret(origin); err != nil {
+				return err
+			}
+		}
+		if len(*f.dst) == 0 {
+			origin = "$" + envName(f.name)
+			*f.dst = os.Getenv(envName(f.name))
+		}
+		if p := os.Getenv(envName(f.name) + "_FILE"); len(*f.dst) == 0 && len(p) != 0 {
+			origin = p
+			if *f.dst, err = readSecret(p); err != nil {
+				return err
+			}
+		}
+		if len(*f.dst) == 0 {
+			origin = "credentials file"
+			*f.dst = f.file
+		}
+		if len(*f.dst) != 0 {
+			slog.Debug("Credential", "name", f.name, "from", origin, "value", redact(*f.dst))
+		}
+	}
+	return nil
+}
+
+// readSecret returns the content of a file holding a secret, like the ones
+// mounted by Docker or Kubernetes.
+func readSecret(p string) (string, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// envName returns the environment variable holding a credential.
+func envName(name string) string {
+	return "RESTROOM_" + strings.ToUpper(name)
+}
+
+// redact hides a secret so it can be logged.
+func redact(s string) string {
+	if len(s) <= 8 {
+		return "****"
+	}
+	return s[:4] + "****"
+}
+
+// section returns the section of the credentials file holding profile,
+// creating it if needed.
+func (cf *credentialsFile) section(profile string) *credentialsFile {
+	if len(profile) == 0 {
+		return cf
+	}
+	if cf.Profiles == nil {
+		cf.Profiles = map[string]*credentialsFile{}
+	}
+	if cf.Profiles[profile] == nil {
+		cf.Profiles[profile] = &credentialsFile{}
+	}
+	return cf.Profiles[profile]
+}
+
+// store saves the credentials file after sec, a section of it, was updated.
+func (cf *credentialsFile) store(sec *credentialsFile, profile string, useKeyring bool) (string, error) {
+	if useKeyring {
+		if err := sec.lock(profile); err != nil {
+			return "", err
+		}
+	} else {
+		sec.Keyring = false
+	}
+	return cf.save()
+}
+
+// authorize runs an authorization flow and saves the resulting tokens.
+//
+// By default it is the out-of-band OAuth 1.0a flow: the user opens the
+// authorization URL and types back the PIN displayed by twitter. With
+// -oauth2, it is the OAuth 2.0 PKCE flow of the API v2.
+func authorize(args []string) error {
+	if len(args) != 0 && args[0] == "verify" {
+		return verifyCredentials(args[1:])
+	}
+	f := flag.NewFlagSet("auth", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "usage: restroom auth -k <consumerkey> -c <consumersecret>\n")
+		fmt.Fprintf(f.Output(), "       restroom auth -oauth2 -client-id <clientid>\n")
+		fmt.Fprintf(f.Output(), "       restroom auth verify\n")
+		f.PrintDefaults()
+	}
+	consumerKey := f.String("k", "", "consumer key")
+	consumerSecret := f.String("c", "", "consumer secret")
+	useOAuth2 := f.Bool("oauth2", false, "use the OAuth 2.0 PKCE flow for the API v2 instead of OAuth 1.0a")
+	clientID := f.String("client-id", "", "OAuth 2.0 client ID, with -oauth2")
+	redirect := f.String("redirect", "http://127.0.0.1:8976/callback", "OAuth 2.0 redirect URL registered for the app, with -oauth2")
+	profile := f.String("profile", "", "save the tokens in this named profile instead of the default one")
+	useKeyring := f.Bool("keyring", false, "store the secrets in the OS keyring instead of the credentials file")
+	proxy := registerProxy(f)
+	logs := registerLog(f)
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+
+	if err := logs.apply(); err != nil {
+		return err
+	}
+	if f.NArg() != 0 {
+		return errors.New("unexpected argument")
+	}
+	if err := setProxy(*proxy); err != nil {
+		return err
+	}
+	all, err := loadCredentialsFile()
+	if err != nil {
+		return err
+	}
+	cf := all.section(*profile)
+	if err := cf.unlock(*profile); err != nil {
+		return err
+	}
+	var name string
+	if *useOAuth2 {
+		if len(*clientID) != 0 {
+			cf.ClientID = *clientID
+		}
+		if len(cf.ClientID) == 0 {
+			return errors.New("-client-id is required. If you don't have one, enable OAuth 2.0 in the settings of your app at https://developer.twitter.com/.")
+		}
+		if name, err = authorizeOAuth2(cf, *redirect); err != nil {
+			return err
+		}
+	} else {
+		if len(*consumerKey) != 0 {
+			cf.ConsumerKey = *consumerKey
+		}
+		if len(*consumerSecret) != 0 {
+			cf.ConsumerSecret = *consumerSecret
+		}
+		eff, err := all.profile(*profile)
+		if err != nil {
+			return err
+		}
+		if name, err = authorizeOAuth1(cf, eff); err != nil {
+			return err
+		}
+	}
+	p, err := all.store(cf, *profile, *useKeyring)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Authorized as @%s; credentials saved in %s\n", name, p)
+	return nil
+}
+
+// authorizeOAuth1 runs the PIN flow with the consumer key of eff and saves the
+// tokens in cf. It returns the screen name of the user.
+func authorizeOAuth1(cf, eff *credentialsFile) (string, error) {
+	if len(eff.ConsumerKey) == 0 || len(eff.ConsumerSecret) == 0 {
+		return "", errors.New("-k and -c are required. If you don't have one, visit https://apps.twitter.com/app/new to create a new app.")
+	}
+	anaconda.SetConsumerKey(eff.ConsumerKey)
+	anaconda.SetConsumerSecret(eff.ConsumerSecret)
+	api := anaconda.NewTwitterApi("", "")
+	defer api.Close()
+	u, tmp, err := api.AuthorizationURL("oob")
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("Open this URL in a browser and authorize the app:\n  %s\nPIN: ", u)
+	pin, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	tok, v, err := api.GetCredentials(tmp, strings.TrimSpace(pin))
+	if err != nil {
+		return "", err
+	}
+	cf.Token = tok.Token
+	cf.TokenSecret = tok.Secret
+	return v.Get("screen_name"), nil
+}
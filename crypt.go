@@ -0,0 +1,139 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// encMagic starts the encrypted cache files. It is followed by the scrypt
+// salt, the AES-GCM nonce and the sealed content.
+const encMagic = "restroom-aes256gcm-scrypt\n"
+
+const (
+	encSaltSize  = 16
+	encNonceSize = 12
+)
+
+// encryptCache is set with -encrypt.
+var encryptCache bool
+
+var (
+	// encPassphrase is read once per process.
+	encPassphrase string
+	// encKeys memoizes the scrypt keys by salt, since scrypt is slow on
+	// purpose and shards are encrypted separately.
+	encKeys = map[string][]byte{}
+	// encSalt is the salt used to encrypt in this process.
+	encSalt []byte
+)
+
+// isEncrypted returns true if b was produced by encrypt.
+func isEncrypted(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(encMagic))
+}
+
+// passphrase returns the passphrase from $RESTROOM_PASSPHRASE,
+// $RESTROOM_PASSPHRASE_FILE or the terminal.
+func passphrase() (string, error) {
+	if len(encPassphrase) != 0 {
+		return encPassphrase, nil
+	}
+	encPassphrase = os.Getenv("RESTROOM_PASSPHRASE")
+	if p := os.Getenv("RESTROOM_PASSPHRASE_FILE"); len(encPassphrase) == 0 && len(p) != 0 {
+		var err error
+		if encPassphrase, err = readSecret(p); err != nil {
+			return "", err
+		}
+	}
+	if len(encPassphrase) == 0 {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return "", errors.New("the cache is encrypted; set $RESTROOM_PASSPHRASE")
+		}
+		fmt.Fprintf(os.Stderr, "Cache passphrase: ")
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintf(os.Stderr, "\n")
+		if err != nil {
+			return "", err
+		}
+		encPassphrase = strings.TrimSpace(string(b))
+	}
+	if len(encPassphrase) == 0 {
+		return "", errors.New("empty passphrase")
+	}
+	return encPassphrase, nil
+}
+
+// encKey returns the AES-GCM cipher derived from the passphrase and salt.
+func encKey(salt []byte) (cipher.AEAD, error) {
+	k, ok := encKeys[string(salt)]
+	if !ok {
+		p, err := passphrase()
+		if err != nil {
+			return nil, err
+		}
+		// The recommended parameters for interactive logins as of 2017.
+		if k, err = scrypt.Key([]byte(p), salt, 1<<15, 8, 1, 32); err != nil {
+			return nil, err
+		}
+		encKeys[string(salt)] = k
+	}
+	b, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(b)
+}
+
+// encrypt seals b with a key derived from the passphrase.
+func encrypt(b []byte) ([]byte, error) {
+	if encSalt == nil {
+		encSalt = make([]byte, encSaltSize)
+		if _, err := rand.Read(encSalt); err != nil {
+			return nil, err
+		}
+	}
+	aead, err := encKey(encSalt)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(encMagic)+encSaltSize+encNonceSize+len(b)+aead.Overhead())
+	out = append(out, encMagic...)
+	out = append(out, encSalt...)
+	nonce := make([]byte, encNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, b, []byte(encMagic)), nil
+}
+
+// decrypt opens b sealed by encrypt.
+func decrypt(b []byte) ([]byte, error) {
+	b = b[len(encMagic):]
+	if len(b) < encSaltSize+encNonceSize {
+		return nil, errors.New("truncated encrypted file")
+	}
+	aead, err := encKey(b[:encSaltSize])
+	if err != nil {
+		return nil, err
+	}
+	nonce := b[encSaltSize : encSaltSize+encNonceSize]
+	out, err := aead.Open(nil, nonce, b[encSaltSize+encNonceSize:], []byte(encMagic))
+	if err != nil {
+		return nil, errors.New("invalid passphrase or corrupted file")
+	}
+	return out, nil
+}
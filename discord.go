@@ -0,0 +1,148 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+func init() {
+	importers["discord"] = importDiscord
+}
+
+// importDiscord parses the messages/c<channel>/messages.csv files of a Discord
+// data package, merging all the channels. p can be the package zip file or
+// the extracted directory.
+//
+// The channel name from messages/index.json is stored as the place.
+func importDiscord(p string, o *importOptions) ([]Tweet, error) {
+	st, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	var fsys fs.FS
+	if st.IsDir() {
+		fsys = os.DirFS(p)
+	} else {
+		z, err := zip.OpenReader(p)
+		if err != nil {
+			return nil, err
+		}
+		defer z.Close()
+		fsys = z
+	}
+	var out []Tweet
+	names := map[string]map[string]string{}
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path.Base(name) != "messages.csv" {
+			return err
+		}
+		dir := path.Dir(name)
+		parent := path.Dir(dir)
+		if _, ok := names[parent]; !ok {
+			names[parent] = discordChannelNames(fsys, path.Join(parent, "index.json"))
+		}
+		channel := strings.TrimPrefix(path.Base(dir), "c")
+		place := names[parent][channel]
+		if len(place) == 0 {
+			place = channel
+		}
+		t, err := readDiscordCSV(fsys, name, place)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		slog.Info("Read messages", "count", len(t), "channel", place)
+		out = append(out, t...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no messages.csv found; is it a Discord data package?")
+	}
+	return out, nil
+}
+
+// discordChannelNames reads the channel ID to name mapping. It is best
+// effort.
+func discordChannelNames(fsys fs.FS, name string) map[string]string {
+	out := map[string]string{}
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return out
+	}
+	var m map[string]*string
+	if err := json.Unmarshal(b, &m); err != nil {
+		slog.Warn("Skipping file", "file", name, "err", err)
+		return out
+	}
+	for k, v := range m {
+		if v != nil {
+			out[k] = *v
+		}
+	}
+	return out
+}
+
+// readDiscordCSV reads a messages.csv file. The columns are ID, Timestamp,
+// Contents and Attachments.
+func readDiscordCSV(fsys fs.FS, name, place string) ([]Tweet, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	ic, err := column(header, "ID")
+	if err != nil {
+		return nil, err
+	}
+	tc, err := column(header, "Timestamp")
+	if err != nil {
+		return nil, err
+	}
+	var out []Tweet
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ic >= len(rec) || tc >= len(rec) {
+			continue
+		}
+		// Message IDs are snowflakes, unique across channels.
+		id, err := strconv.ParseInt(rec[ic], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid message id %q: %w", rec[ic], err)
+		}
+		t, err := time.Parse("2006-01-02 15:04:05.999999-07:00", rec[tc])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, Tweet{CreatedAt: t, Id: id, Place: place})
+	}
+}
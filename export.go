@@ -0,0 +1,81 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// exportCmd prints the cached tweets of the users as a JSON array or as CSV,
+// from the most recent to the oldest.
+func exportCmd(args []string) error {
+	format := "json"
+	if len(args) != 0 && (args[0] == "json" || args[0] == "csv") {
+		format, args = args[0], args[1:]
+	}
+	f := flag.NewFlagSet("export", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "usage: restroom export [json | csv] [-u <user> | -q <query> | -users-file <file>]\n")
+		f.PrintDefaults()
+	}
+	t := registerTargets(f, false)
+	registerStore(f)
+	logs := registerLog(f)
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+
+	if err := logs.apply(); err != nil {
+		return err
+	}
+	if f.NArg() != 0 {
+		return errors.New("unexpected argument")
+	}
+	def, err := t.sourceDef(false)
+	if err != nil {
+		return err
+	}
+	// The report is generated from the cache only.
+	goOffline()
+	c := load()
+	defer c.save()
+	keys, err := t.keys(c, def.new(&credentials{}))
+	if err != nil {
+		return err
+	}
+	var all []Tweet
+	for _, k := range keys {
+		all = append(all, c.get(k)...)
+	}
+	sortTweets(all)
+	if format == "csv" {
+		return exportCSV(os.Stdout, all)
+	}
+	if all == nil {
+		all = []Tweet{}
+	}
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "  ")
+	return e.Encode(all)
+}
+
+// exportCSV prints the ID, time in UTC and place of each tweet.
+func exportCSV(w io.Writer, l []Tweet) error {
+	c := csv.NewWriter(w)
+	c.Write([]string{"id", "created_at", "place"})
+	for _, t := range l {
+		c.Write([]string{strconv.FormatInt(t.Id, 10), t.CreatedAt.UTC().Format(time.RFC3339), t.Place})
+	}
+	c.Flush()
+	return c.Error()
+}
@@ -0,0 +1,398 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// fetcher fetches the tweets of users into the cache, possibly with several
+// workers at once.
+type fetcher struct {
+	c *cache
+	// skip is set with -users-file to skip the users fetched more recently.
+	skip         time.Duration
+	checkDeleted bool
+
+	// mu protects c and limited.
+	mu sync.Mutex
+	// limited is set once a quota is used up, to stop fetching.
+	limited bool
+}
+
+// worker fetches one user at a time.
+type worker struct {
+	f   *fetcher
+	src Source
+	pg  Pager
+	// key is the cache key being fetched and added the number of new tweets
+	// saved so far for it.
+	key   string
+	added int
+	// name is the user or the query being fetched, for the progress.
+	name string
+}
+
+// newWorker returns a worker fetching with src. If src is a Pager, each page
+// is saved as it is retrieved, so an interrupted fetch keeps its progress.
+func (f *fetcher) newWorker(src Source) *worker {
+	w := &worker{f: f, src: src}
+	w.pg, _ = src.(Pager)
+	if w.pg != nil {
+		w.pg.OnPage(func(tweets []Tweet, cursor string) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			w.added += f.c.merge(w.key, tweets)
+			fetchProgress.page(w.name, len(tweets))
+			if len(cursor) != 0 {
+				f.c.Cursors[w.key] = cursor
+			} else {
+				delete(f.c.Cursors, w.key)
+			}
+			f.c.save()
+		})
+	}
+	return w
+}
+
+// start prepares the worker to fetch key, resuming the interrupted fetch if
+// any.
+func (w *worker) start(key string) {
+	w.key, w.added = key, 0
+	if w.pg != nil {
+		w.f.mu.Lock()
+		cursor := w.f.c.Cursors[key]
+		w.f.mu.Unlock()
+		w.pg.Resume(cursor)
+	}
+}
+
+// fetchUsers fetches users with one worker per Source in srcs, and returns the
+// cache keys of the users in the same order.
+//
+// The sources must share their rate limiters.
+func (f *fetcher) fetchUsers(ctx context.Context, users []string, srcs []Source) ([]string, error) {
+	keys := make([]string, len(users))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := make(chan int)
+	errs := make(chan error, len(srcs))
+	for _, src := range srcs {
+		w := f.newWorker(src)
+		go func() {
+			var err error
+			for i := range jobs {
+				if err != nil {
+					continue
+				}
+				if keys[i], err = w.fetchUser(ctx, users[i], i, len(users)); err != nil {
+					// Stop the other workers.
+					cancel()
+				}
+			}
+			errs <- err
+		}()
+	}
+	for i := range users {
+		jobs <- i
+	}
+	close(jobs)
+	var err error
+	for range srcs {
+		// Report the error that stopped the other workers.
+		if err2 := <-errs; err2 != nil && (err == nil || err == errInterrupted) {
+			err = err2
+		}
+	}
+	return keys, err
+}
+
+// fetchUser fetches the tweets of u, the i-th of n users, and returns the key
+// they are cached under.
+func (w *worker) fetchUser(ctx context.Context, u string, i, n int) (string, error) {
+	f, c := w.f, w.f.c
+	if ctx.Err() != nil {
+		return "", errInterrupted
+	}
+	w.name = u
+	fetchProgress.begin(u)
+	defer fetchProgress.end(u)
+	f.mu.Lock()
+	key := c.resolve(w.src.Key(u))
+	stale := f.skip == 0 || time.Since(c.Fetched[key]) >= f.skip
+	f.mu.Unlock()
+	if r, ok := w.src.(Resolver); ok && stale {
+		id, err := r.Resolve(ctx, u)
+		if ctx.Err() != nil {
+			return "", errInterrupted
+		}
+		if err == nil {
+			key = w.src.Key(id)
+			f.mu.Lock()
+			c.alias(w.src.Key(u), key)
+			if z, ok := w.src.(Timezoner); ok {
+				if tz := z.Timezone(); len(tz) != 0 {
+					c.Timezones[key] = tz
+				}
+			}
+			f.mu.Unlock()
+		} else if a := asAccountError(err); a != nil {
+			return key, skipAccount(u, a, n)
+		} else if !errors.Is(err, errNoCredentials) {
+			return "", err
+		}
+	}
+	f.mu.Lock()
+	fetched, limited := c.Fetched[key], f.limited
+	f.mu.Unlock()
+	if f.skip != 0 && time.Since(fetched) < f.skip {
+		slog.Info("Skipping recently fetched user", "user", u, "ago", time.Since(fetched).Round(time.Second))
+		return key, nil
+	}
+	if limited {
+		return key, nil
+	}
+	w.start(key)
+	f.mu.Lock()
+	cached := c.get(key)
+	f.mu.Unlock()
+	tweets, err := w.src.Fetch(ctx, u, cached)
+	if w.pg == nil {
+		fetchProgress.page(u, len(tweets))
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if ctx.Err() != nil {
+		c.merge(key, tweets)
+		return key, errInterrupted
+	}
+	if errors.Is(err, errNoCredentials) {
+		return key, nil
+	}
+	if errors.Is(err, errRateLimited) {
+		// Stop fetching but report on what is cached.
+		f.setLimited(err)
+		c.merge(key, tweets)
+		return key, nil
+	}
+	if a := asAccountError(err); a != nil {
+		c.merge(key, tweets)
+		return key, skipAccount(u, a, n)
+	}
+	if err != nil {
+		// Keep what was retrieved before the error.
+		if added := c.merge(key, tweets); added != 0 {
+			slog.Info("Added new tweets before the error", "user", u, "count", added)
+		}
+		return key, err
+	}
+	slog.Info("Added new tweets", "user", u, "count", w.added+c.merge(key, tweets), "index", i+1, "users", n)
+	if f.checkDeleted {
+		l := c.get(key)
+		ids := make([]int64, 0, len(l))
+		for _, t := range l {
+			ids = append(ids, t.Id)
+		}
+		// Don't block the other workers during the lookup.
+		f.mu.Unlock()
+		existing, err := w.src.(Verifier).Existing(ctx, ids)
+		f.mu.Lock()
+		if ctx.Err() != nil {
+			return key, errInterrupted
+		}
+		if errors.Is(err, errRateLimited) {
+			f.setLimited(err)
+		} else if err != nil {
+			return key, err
+		} else {
+			d, err := c.markDeleted(key, existing)
+			if err != nil {
+				return key, err
+			}
+			slog.Info("Found newly deleted tweets", "user", u, "count", d)
+		}
+	}
+	c.Fetched[key] = time.Now().UTC()
+	if n > 1 {
+		// Save progress so an interrupted run resumes where it left off.
+		c.save()
+	}
+	return key, nil
+}
+
+// skipAccount reports that the posts of u cannot be fetched. It is an error
+// only when u is the only user, otherwise the other users are fetched.
+func skipAccount(u string, a *accountError, n int) error {
+	slog.Warn("Account unavailable", "user", u, "err", a)
+	if n == 1 {
+		return fmt.Errorf("%s %s", u, a.reason)
+	}
+	warnf("%s %s; skipping", u, a.reason)
+	return nil
+}
+
+// setLimited records that a quota was used up. f.mu must be held.
+func (f *fetcher) setLimited(err error) {
+	if !f.limited {
+		warnf("%s; reporting the cached tweets", err)
+		f.limited = true
+	}
+}
+
+// fetchOptions are the flags of the fetch command.
+type fetchOptions struct {
+	*targets
+	refresh      time.Duration
+	workers      int
+	checkDeleted bool
+	cred         *credentials
+	proxy        *string
+}
+
+// registerFetch registers the flags of the fetch command on f.
+func registerFetch(f *flag.FlagSet) *fetchOptions {
+	o := &fetchOptions{targets: registerTargets(f, true)}
+	f.DurationVar(&o.refresh, "refresh", 24*time.Hour, "with -users-file, skip the users fetched more recently than this")
+	f.IntVar(&maxAttempts, "max-attempts", maxAttempts, "how many times to try the API calls failing with a network or server error")
+	f.BoolVar(&waitLimits, "wait", false, "sleep as long as needed for the API quotas to reset instead of stopping, for large backfills")
+	f.IntVar(&o.workers, "workers", 1, "with -list or -users-file, number of users fetched concurrently")
+	f.IntVar(&maxPages, "max-pages", 0, "maximum number of pages requested in a row for each user; defaults to the source's")
+	f.IntVar(&pageSize, "page-size", 0, "number of posts requested per page; defaults to the maximum allowed by the API")
+	f.IntVar(&maxTweets, "max-tweets", 0, "stop fetching a user once this many new posts were retrieved; 0 for no limit")
+	f.BoolVar(&o.checkDeleted, "check-deleted", false, "look up the cached tweets of the users and record the ones that were deleted")
+	o.cred = registerCredentials(f)
+	o.proxy = registerProxy(f)
+	return o
+}
+
+// fetch fetches the targets into c and returns the cache keys they are stored
+// under.
+func (o *fetchOptions) fetch(c *cache) ([]string, error) {
+	if err := setProxy(*o.proxy); err != nil {
+		return nil, err
+	}
+	if maxPages < 0 || pageSize < 0 || maxTweets < 0 {
+		return nil, errors.New("-max-pages, -page-size and -max-tweets cannot be negative")
+	}
+	def, err := o.sourceDef(true)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.cred.loadDefaults(); err != nil {
+		return nil, err
+	}
+	src := def.new(o.cred)
+	// Ctrl-C cancels the requests in flight, then the tweets retrieved so far
+	// are saved.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	f := &fetcher{c: c, checkDeleted: o.checkDeleted}
+	if len(o.query) != 0 {
+		s, ok := src.(Searcher)
+		if !ok {
+			return nil, fmt.Errorf("-source %s doesn't support -q", o.source)
+		}
+		// Queries are stored in their own bucket, shared by all sources.
+		key := "q:" + o.query
+		w := f.newWorker(src)
+		w.name = o.query
+		w.start(key)
+		p := startProgress(1)
+		p.begin(o.query)
+		tweets, err := s.Search(ctx, o.query, c.get(key))
+		p.stop()
+		if ctx.Err() != nil {
+			c.merge(key, tweets)
+			return nil, errInterrupted
+		}
+		if errors.Is(err, errRateLimited) {
+			warnf("%s; reporting the cached tweets", err)
+			err = nil
+		}
+		if err == nil {
+			slog.Info("Added new tweets", "query", o.query, "count", w.added+c.merge(key, tweets))
+		} else if !errors.Is(err, errNoCredentials) {
+			return nil, err
+		}
+		return []string{key}, nil
+	}
+	users := o.users
+	if len(o.list) != 0 {
+		l, ok := src.(Lister)
+		if !ok {
+			return nil, fmt.Errorf("-source %s doesn't support -list", o.source)
+		}
+		if users, err = l.Members(ctx, o.list); err != nil {
+			if ctx.Err() != nil {
+				return nil, errInterrupted
+			}
+			return nil, err
+		}
+		if len(users) == 0 {
+			return nil, fmt.Errorf("list %s has no members", o.list)
+		}
+		slog.Info("Listed members", "list", o.list, "count", len(users))
+	}
+	if len(o.usersFile) != 0 {
+		if users, err = readUsers(o.usersFile); err != nil {
+			return nil, err
+		}
+		f.skip = o.refresh
+	}
+	if o.checkDeleted {
+		if _, ok := src.(Verifier); !ok {
+			return nil, fmt.Errorf("-source %s doesn't support -check-deleted", o.source)
+		}
+	}
+	if o.workers < 1 {
+		return nil, errors.New("-workers must be at least 1")
+	}
+	// Each worker needs its own Source since a Pager keeps the state of the
+	// fetch in progress.
+	srcs := []Source{src}
+	for len(srcs) < o.workers && len(srcs) < len(users) {
+		srcs = append(srcs, def.new(o.cred))
+	}
+	p := startProgress(len(users))
+	defer p.stop()
+	return f.fetchUsers(ctx, users, srcs)
+}
+
+// fetchCmd fetches the posts of the users or the search query into the cache.
+func fetchCmd(args []string) error {
+	f := flag.NewFlagSet("fetch", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "usage: restroom fetch [-u <user> | -q <query> | -list <owner/slug> | -users-file <file>]\n")
+		f.PrintDefaults()
+	}
+	o := registerFetch(f)
+	registerColor(f)
+	registerStore(f)
+	logs := registerLog(f)
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+
+	if err := logs.apply(); err != nil {
+		return err
+	}
+	if f.NArg() != 0 {
+		return errors.New("unexpected argument")
+	}
+	c := load()
+	defer c.save()
+	_, err := o.fetch(c)
+	return err
+}
@@ -0,0 +1,82 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+func init() {
+	registerSource("github", sourceDef{
+		new: func(cred *credentials) Source { return &githubSource{token: cred.Token} },
+	})
+}
+
+type githubEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Repo      struct {
+		Name string `json:"name"`
+	} `json:"repo"`
+}
+
+// githubSource fetches the public events (pushes, issues, comments, etc) of a
+// GitHub user.
+//
+// The repository is stored as the place. token is optional, it raises the rate
+// limit from 60 to 5000 requests per hour.
+type githubSource struct {
+	token string
+}
+
+func (g *githubSource) Key(user string) string {
+	return "github:" + user
+}
+
+func (g *githubSource) Fetch(ctx context.Context, user string, cached []Tweet) ([]Tweet, error) {
+	// https://docs.github.com/en/rest/activity/events#list-public-events-for-a-user
+	// - "per_page" is limited to 100.
+	// - Only the events of the last 90 days are returned, up to 300 events.
+	// It's not possible to page backward from a known event so everything is
+	// fetched and deduped on merge.
+	var out []Tweet
+	size := pageLen(100)
+	for page := 1; page <= pageCount(300/size) && !enough(len(out)); page++ {
+		v := url.Values{"per_page": {strconv.Itoa(size)}, "page": {strconv.Itoa(page)}}
+		slog.Debug("Fetching")
+		var events []githubEvent
+		h, err := getJSONHeader(ctx, "https://api.github.com/users/"+url.PathEscape(user)+"/events/public?"+v.Encode(), g.token, &events)
+		if err != nil {
+			if h.Get("X-RateLimit-Remaining") == "0" {
+				if reset, err2 := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err2 == nil {
+					err = fmt.Errorf("%w until %s; use -t to raise the limit", errRateLimited, time.Unix(reset, 0).Format(time.Kitchen))
+				}
+			}
+			if page == 1 {
+				return nil, err
+			}
+			break
+		}
+		slog.Debug("Retrieved events", "count", len(events))
+		for _, e := range events {
+			id, err := strconv.ParseInt(e.ID, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid event id %q: %w", e.ID, err)
+			}
+			out = append(out, Tweet{CreatedAt: e.CreatedAt, Id: id, Place: e.Repo.Name})
+		}
+		if len(events) < size {
+			break
+		}
+	}
+	return out, nil
+}
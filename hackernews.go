@@ -0,0 +1,97 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const hnURL = "https://hacker-news.firebaseio.com/v0/"
+
+func init() {
+	registerSource("hn", sourceDef{
+		new: func(cred *credentials) Source { return &hnSource{} },
+	})
+}
+
+type hnItem struct {
+	ID      int64  `json:"id"`
+	Type    string `json:"type"`
+	Time    int64  `json:"time"`
+	Deleted bool   `json:"deleted"`
+}
+
+// hnSource fetches the submissions and comments of a Hacker News user. No
+// authentication is needed.
+type hnSource struct{}
+
+func (h *hnSource) Key(user string) string {
+	return "hn:" + user
+}
+
+func (h *hnSource) Fetch(ctx context.Context, user string, cached []Tweet) ([]Tweet, error) {
+	// https://github.com/HackerNews/API
+	// The user lists all its item IDs, then each item has to be fetched
+	// individually. There is no rate limit.
+	var u struct {
+		Submitted []int64 `json:"submitted"`
+	}
+	if err := getJSON(ctx, hnURL+"user/"+url.PathEscape(user)+".json", "", &u); err != nil {
+		return nil, err
+	}
+	if u.Submitted == nil {
+		return nil, errors.New("user not found")
+	}
+	known := make(map[int64]struct{}, len(cached))
+	for _, t := range cached {
+		known[t.Id] = struct{}{}
+	}
+	ids := make(chan int64)
+	go func() {
+		for _, id := range u.Submitted {
+			if _, ok := known[id]; !ok {
+				ids <- id
+			}
+		}
+		close(ids)
+	}()
+	slog.Debug("Fetching items", "count", len(u.Submitted)-len(known))
+	var mu sync.Mutex
+	var out []Tweet
+	var firstErr error
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				var item hnItem
+				err := getJSON(ctx, hnURL+"item/"+strconv.FormatInt(id, 10)+".json", "", &item)
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+				} else if !item.Deleted && item.Time != 0 {
+					out = append(out, Tweet{CreatedAt: time.Unix(item.Time, 0).UTC(), Id: item.ID})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	slog.Debug("Retrieved items", "count", len(out))
+	if len(out) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// hashtag is how much a hashtag is used.
+type hashtag struct {
+	// Tag is without the '#', as spelled the first time it was used.
+	Tag    string
+	Tweets int
+	// First and Last are when it was first and last used.
+	First time.Time
+	Last  time.Time
+}
+
+// tagCount is the number of tweets with a hashtag.
+type tagCount struct {
+	Tag    string
+	Tweets int
+}
+
+// hashtagCounter counts the hashtags of tweets. The tags are compared case
+// insensitively.
+type hashtagCounter struct {
+	tags   map[string]*hashtag
+	months map[string]map[string]int
+}
+
+func newHashtagCounter() *hashtagCounter {
+	return &hashtagCounter{tags: map[string]*hashtag{}, months: map[string]map[string]int{}}
+}
+
+// add counts the hashtags of t.
+func (h *hashtagCounter) add(t *Tweet) {
+	month := t.CreatedAt.Format("2006-01")
+	seen := map[string]bool{}
+	for _, tag := range t.Hashtags {
+		k := strings.ToLower(tag)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		e := h.tags[k]
+		if e == nil {
+			e = &hashtag{Tag: tag, First: t.CreatedAt, Last: t.CreatedAt}
+			h.tags[k] = e
+		}
+		e.Tweets++
+		if t.CreatedAt.Before(e.First) {
+			e.Tag, e.First = tag, t.CreatedAt
+		}
+		if t.CreatedAt.After(e.Last) {
+			e.Last = t.CreatedAt
+		}
+		if h.months[month] == nil {
+			h.months[month] = map[string]int{}
+		}
+		h.months[month][k]++
+	}
+}
+
+// top returns the n most used hashtags and the n most used each month.
+func (h *hashtagCounter) top(n int) ([]hashtag, map[string][]tagCount) {
+	if n == 0 || len(h.tags) == 0 {
+		return nil, nil
+	}
+	counts := make(map[string]int, len(h.tags))
+	for k, e := range h.tags {
+		counts[k] = e.Tweets
+	}
+	var tags []hashtag
+	for _, k := range byCount(counts) {
+		if len(tags) == n {
+			break
+		}
+		tags = append(tags, *h.tags[k])
+	}
+	months := make(map[string][]tagCount, len(h.months))
+	for m, c := range h.months {
+		for _, k := range byCount(c) {
+			if len(months[m]) == n {
+				break
+			}
+			months[m] = append(months[m], tagCount{Tag: h.tags[k].Tag, Tweets: c[k]})
+		}
+	}
+	return tags, months
+}
+
+// hashtagMonths returns the months of s with hashtags, sorted.
+func (s *stats) hashtagMonths() []string {
+	out := make([]string, 0, len(s.MonthHashtags))
+	for m := range s.MonthHashtags {
+		out = append(out, m)
+	}
+	sort.Strings(out)
+	return out
+}
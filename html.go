@@ -0,0 +1,335 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+)
+
+func init() {
+	outputs["html"] = printHTML
+}
+
+// htmlFuncs are the functions of htmlReport, to render the sections as
+// selected with -lang, -week-start, -clock and -places-sort.
+var htmlFuncs = template.FuncMap{
+	"version":      version,
+	"weekdays":     func() []string { return cal.days[:] },
+	"weekdayAbbr":  func() []string { return cal.abbr[:] },
+	"weekOrder":    func() []time.Weekday { return cal.order() },
+	"hourLabels":   func() []string { return hourLabels(hourLabel) },
+	"hourTicks":    func() []string { return hourLabels(hourTick) },
+	"clockLabels":  func() []string { return hourLabels(clockLabel) },
+	"placesByName": func() bool { return placesByName },
+}
+
+// hourLabels returns the labels of the 24 hours.
+func hourLabels(label func(h int) string) []string {
+	out := make([]string, 24)
+	for h := range out {
+		out[h] = label(h)
+	}
+	return out
+}
+
+// htmlReport is a self-contained page; the charts are drawn as SVG by the
+// embedded script so the page can be shared as a single file.
+var htmlReport = template.Must(template.New("report").Funcs(htmlFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="generator" content="{{version}}">
+<title>restroom report</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: auto; color: #222; }
+h2 { border-bottom: 1px solid #ccc; }
+.chart { margin: 1em 0; }
+.chart rect, .chart circle { fill: #4a7ebb; }
+.chart rect:hover, .chart circle:hover { fill: #e07b39; }
+.chart polyline { fill: none; stroke: #4a7ebb; stroke-width: 2; }
+.chart text { font-size: 11px; fill: #555; }
+footer { color: #777; font-size: small; margin: 2em 0; }
+</style>
+</head>
+<body>
+<h1>restroom report</h1>
+<div id="report"></div>
+<script>
+const sections = {{.}};
+// weekdays are indexed like the Weekdays of the sections, starting on Sunday,
+// and weekOrder is the order to show them in.
+const weekdays = {{weekdays}};
+const weekdayAbbr = {{weekdayAbbr}};
+const weekOrder = {{weekOrder}};
+const hourLabels = {{hourLabels}};
+const hourTicks = {{hourTicks}};
+const clockLabels = {{clockLabels}};
+const placesByName = {{placesByName}};
+const svgTags = new Set(["svg", "rect", "circle", "polyline", "text", "title"]);
+
+function el(parent, name, attrs, text) {
+  const e = svgTags.has(name) ? document.createElementNS("http://www.w3.org/2000/svg", name) : document.createElement(name);
+  for (const k in attrs || {}) {
+    e.setAttribute(k, attrs[k]);
+  }
+  if (text !== undefined) {
+    e.textContent = text;
+  }
+  parent.appendChild(e);
+  return e;
+}
+
+// bars draws a vertical bar per label; hovering a bar shows its value. The
+// axis shows the ticks, or the labels when not specified.
+function bars(parent, title, labels, values, ticks) {
+  el(parent, "h3", {}, title);
+  const w = 40 + labels.length * 28, h = 180, max = Math.max(1, ...values);
+  const svg = el(parent, "svg", {class: "chart", width: w, height: h + 40});
+  labels.forEach((l, i) => {
+    const bh = h * values[i] / max, x = 40 + i * 28;
+    const r = el(svg, "rect", {x: x, y: h - bh + 10, width: 22, height: bh});
+    el(r, "title", {}, l + ": " + values[i]);
+    el(svg, "text", {x: x + 11, y: h + 25, "text-anchor": "middle"}, (ticks || labels)[i]);
+  });
+  el(svg, "text", {x: 0, y: 15}, max);
+}
+
+// bucketLabels returns the label of each bucket of a histogram from the lower
+// bound of the buckets; the last one is open-ended.
+function bucketLabels(edges) {
+  return edges.map((e, i) => e + (i === edges.length - 1 ? "+" : "-" + (edges[i + 1] - 1)));
+}
+
+// hbars draws a horizontal bar per label, for long labels like places.
+function hbars(parent, title, labels, values) {
+  el(parent, "h3", {}, title);
+  const h = labels.length * 22, max = Math.max(1, ...values);
+  const svg = el(parent, "svg", {class: "chart", width: 700, height: h + 10});
+  labels.forEach((l, i) => {
+    const y = i * 22;
+    el(svg, "text", {x: 245, y: y + 15, "text-anchor": "end"}, l);
+    const r = el(svg, "rect", {x: 250, y: y + 3, width: 400 * values[i] / max, height: 16});
+    el(r, "title", {}, l + ": " + values[i]);
+  });
+}
+
+// line draws the tweets per month, including the months without any.
+function line(parent, title, months) {
+  const keys = Object.keys(months || {}).sort();
+  if (keys.length === 0) {
+    return;
+  }
+  const labels = [], values = [];
+  let [y, m] = keys[0].split("-").map(Number);
+  for (;;) {
+    const k = y + "-" + String(m).padStart(2, "0");
+    labels.push(k);
+    values.push(months[k] || 0);
+    if (k >= keys[keys.length - 1]) {
+      break;
+    }
+    if (++m > 12) {
+      m = 1;
+      y++;
+    }
+  }
+  el(parent, "h3", {}, title);
+  const w = 700, h = 180, max = Math.max(1, ...values);
+  const step = labels.length > 1 ? (w - 50) / (labels.length - 1) : 0;
+  const svg = el(parent, "svg", {class: "chart", width: w, height: h + 40});
+  const points = values.map((v, i) => [40 + i * step, 10 + h - h * v / max]);
+  el(svg, "polyline", {points: points.map(p => p.join(",")).join(" ")});
+  points.forEach((p, i) => {
+    const c = el(svg, "circle", {cx: p[0], cy: p[1], r: 3});
+    el(c, "title", {}, labels[i] + ": " + values[i]);
+  });
+  el(svg, "text", {x: 0, y: 15}, max);
+  el(svg, "text", {x: 40, y: h + 30}, labels[0]);
+  el(svg, "text", {x: w - 10, y: h + 30, "text-anchor": "end"}, labels[labels.length - 1]);
+}
+
+// punchcard draws a circle per weekday and hour whose area is proportional to
+// the value.
+function punchcard(parent, title, matrix) {
+  el(parent, "h3", {}, title);
+  const cell = 26, max = Math.max(1, ...matrix.flat());
+  const svg = el(parent, "svg", {class: "chart", width: 40 + 24 * cell, height: 7 * cell + 25});
+  weekOrder.forEach((d, i) => {
+    const y = i * cell + cell / 2;
+    el(svg, "text", {x: 34, y: y + 4, "text-anchor": "end"}, weekdayAbbr[d]);
+    matrix[d].forEach((v, h) => {
+      if (v) {
+        const c = el(svg, "circle", {cx: 40 + h * cell + cell / 2, cy: y, r: (cell / 2 - 1) * Math.sqrt(v / max)});
+        el(c, "title", {}, weekdays[d] + " " + hourLabels[h] + ": " + v);
+      }
+    });
+  });
+  for (let h = 0; h < 24; h++) {
+    el(svg, "text", {x: 40 + h * cell + cell / 2, y: 7 * cell + 15, "text-anchor": "middle"}, hourTicks[h]);
+  }
+}
+
+// cadence returns the streaks and the intervals between the tweets as text.
+function cadence(c) {
+  const days = n => n + (n === 1 ? " day" : " days");
+  let t = "Longest streak: " + days(c.LongestStreak) + " from " + c.StreakFrom;
+  if (c.LongestDrought) {
+    t += ", longest drought: " + days(c.LongestDrought) + " from " + c.DroughtFrom;
+  }
+  t += ", " + (c.PerDay < 1 ? c.PerDay.toPrecision(2) : c.PerDay.toFixed(1)) + " tweets per day";
+  if (c.MedianInterval) {
+    const m = c.MedianInterval / 60;
+    t += ", median interval: " + (m < 60 ? Math.round(m) + "m" : m < 2880 ? (m / 60).toFixed(1) + "h" : (m / 1440).toFixed(1) + " days");
+  }
+  return t + ".";
+}
+
+const root = document.getElementById("report");
+for (const s of sections) {
+  const d = el(root, "div");
+  if (s.Name) {
+    el(d, "h2", {}, s.Name);
+  }
+  if (!s.Tweets) {
+    el(d, "p", {}, "No tweets.");
+    continue;
+  }
+  el(d, "p", {}, s.Tweets + " tweets from " + s.From.slice(0, 10) + " to " + s.To.slice(0, 10) + ", in " + s.Timezone + ".");
+  if (s.Cadence) {
+    el(d, "p", {}, cadence(s.Cadence));
+  }
+  if (s.Gaps) {
+    el(d, "h3", {}, "Largest gaps");
+    const ul = el(d, "ul");
+    for (const g of s.Gaps) {
+      const days = (Date.parse(g.To) - Date.parse(g.From)) / 86400000;
+      const n = days < 2 ? 16 : 10;
+      let t = g.From.slice(0, n).replace("T", " ") + " to " + g.To.slice(0, n).replace("T", " ") + ": " + days.toFixed(1) + " days";
+      if (g.Wall) {
+        t += " (the 3,200 most recent tweets start after it; import the archive for the older ones)";
+      }
+      el(ul, "li", {}, t);
+    }
+  }
+  const who = s.Mentions ? "Mentions received" : "Tweets";
+  bars(d, who + " by hour", hourLabels, s.Hours, hourTicks);
+  if (s.Chronotype) {
+    const c = s.Chronotype, to = (c.SleepFrom + c.SleepHours) % 24;
+    const level = c.Confidence >= 0.7 ? "high" : c.Confidence >= 0.4 ? "medium" : "low";
+    el(d, "p", {}, "Chronotype: " + c.Label + ", likely asleep from " + clockLabels[c.SleepFrom] + " to " + clockLabels[to] + " (" + level + " confidence, " + c.Confidence.toFixed(2) + ").");
+  }
+  bars(d, who + " by weekday", weekOrder.map(i => weekdays[i]), weekOrder.map(i => s.Weekdays[i]), weekOrder.map(i => weekdayAbbr[i]));
+  punchcard(d, who + " by weekday and hour", s.Punchcard);
+  line(d, who + " per month", s.Months);
+  const years = Object.keys(s.Years || {}).sort();
+  if (years.length) {
+    const all = [];
+    for (let y = Number(years[0]); y <= Number(years[years.length - 1]); y++) {
+      all.push(String(y));
+    }
+    bars(d, who + " per year", all, all.map(y => s.Years[y] || 0));
+  }
+  const kinds = ["original", "reply", "retweet", "quote", "unknown"].filter(k => (s.Kinds || {})[k]);
+  if (kinds.length) {
+    hbars(d, "Composition", kinds.map(k => k + " (" + (100 * s.Kinds[k] / s.Tweets).toFixed(1) + "%)"), kinds.map(k => s.Kinds[k]));
+    for (const k of kinds) {
+      bars(d, "Share of " + k + " per hour, in %", hourLabels, s.KindHours[k].map((n, h) => s.Hours[h] ? Math.round(100 * n / s.Hours[h]) : 0), hourTicks);
+    }
+  }
+  for (const k of ["original", "reply"].filter(k => (s.Lengths || {})[k])) {
+    const l = s.Lengths[k];
+    el(d, "p", {}, "Length of the " + l.Tweets + " " + k + " tweets: median " + l.MedianChars + " characters (mean " + l.MeanChars.toFixed(1) + "), " + l.MedianWords + " words (mean " + l.MeanWords.toFixed(1) + "), " + (100 * l.AtLimit / l.Tweets).toFixed(1) + "% at the limit.");
+    bars(d, "Characters of the " + k + " tweets", bucketLabels(l.CharsEdges), l.Chars, l.CharsEdges);
+    bars(d, "Words of the " + k + " tweets", bucketLabels(l.WordsEdges), l.Words, l.WordsEdges);
+  }
+  const clients = Object.keys(s.Clients || {}).sort().sort((a, b) => s.Clients[b] - s.Clients[a]);
+  if (clients.length) {
+    hbars(d, "Clients", clients, clients.map(c => s.Clients[c]));
+    for (const c of clients.slice(0, 3)) {
+      bars(d, who + " from " + c + " by hour", hourLabels, s.ClientHours[c], hourTicks);
+    }
+  }
+  if (s.Hashtags) {
+    hbars(d, "Hashtags", s.Hashtags.map(h => "#" + h.Tag + " (" + h.First.slice(0, 10) + " to " + h.Last.slice(0, 10) + ")"), s.Hashtags.map(h => h.Tweets));
+    el(d, "h3", {}, "Hashtags per month");
+    const ul = el(d, "ul");
+    for (const m of Object.keys(s.MonthHashtags).sort()) {
+      el(ul, "li", {}, m + ": " + s.MonthHashtags[m].map(t => "#" + t.Tag + " " + t.Tweets).join(", "));
+    }
+  }
+  if (s.Partners) {
+    hbars(d, "Interactions", s.Partners.map(p => "@" + p.User + " (" + (100 * p.Tweets / s.Tweets).toFixed(1) + "%)"), s.Partners.map(p => p.Tweets));
+  }
+  const places = Object.keys(s.Places || {}).sort();
+  if (!placesByName) {
+    places.sort((a, b) => s.Places[b] - s.Places[a]);
+  }
+  if (places.length) {
+    hbars(d, "Favorite places", places, places.map(p => s.Places[p]));
+  }
+}
+</script>
+<footer>Generated by {{version}}.</footer>
+</body>
+</html>
+`))
+
+// printHTML prints a self-contained HTML page with the charts.
+func printHTML(w io.Writer, l []*stats) error {
+	return htmlReport.Execute(w, l)
+}
+
+// reportCmd writes the stats as a HTML page to share.
+func reportCmd(args []string) error {
+	f := flag.NewFlagSet("report", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "usage: restroom report [-u <user> | -q <query> | -users-file <file>] [-o <file>]\n")
+		f.PrintDefaults()
+	}
+	t := registerTargets(f, false)
+	o := registerStats(f, false)
+	out := f.String("o", "report.html", "file to write the HTML report to")
+	registerStore(f)
+	logs := registerLog(f)
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+
+	if err := logs.apply(); err != nil {
+		return err
+	}
+	if f.NArg() != 0 {
+		return errors.New("unexpected argument")
+	}
+	def, err := t.sourceDef(false)
+	if err != nil {
+		return err
+	}
+	if err := o.parse(); err != nil {
+		return err
+	}
+	goOffline()
+	c := load()
+	defer c.save()
+	keys, err := t.keys(c, def.new(&credentials{}))
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err := printHTML(&b, o.sections(c, t, keys)); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(*out, b.Bytes(), 0644, false); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s\n", *out)
+	return nil
+}
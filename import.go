@@ -0,0 +1,215 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// importOptions is the column mapping of generic event files.
+type importOptions struct {
+	// timeField is the column name or 0-based index in CSV, or the field name
+	// in NDJSON.
+	timeField string
+	// placeField is optional.
+	placeField string
+	// timeFormat is a Go time layout, or "unix" or "unixms".
+	timeFormat string
+	// from is the sender name or ID to keep, for chat exports.
+	from string
+}
+
+// importers parse an event file by format name.
+var importers = map[string]func(p string, o *importOptions) ([]Tweet, error){
+	"csv":    importCSV,
+	"ndjson": importNDJSON,
+}
+
+func (o *importOptions) parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	switch o.timeFormat {
+	case "unix", "unixms":
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			f, err2 := strconv.ParseFloat(s, 64)
+			if err2 != nil {
+				return time.Time{}, err
+			}
+			i = int64(f)
+		}
+		if o.timeFormat == "unixms" {
+			return time.UnixMilli(i).UTC(), nil
+		}
+		return time.Unix(i, 0).UTC(), nil
+	default:
+		return time.Parse(o.timeFormat, s)
+	}
+}
+
+// column returns the index of name in header, or name as an index.
+func column(header []string, name string) (int, error) {
+	for i, h := range header {
+		if strings.TrimSpace(h) == name {
+			return i, nil
+		}
+	}
+	if i, err := strconv.Atoi(name); err == nil && i >= 0 && i < len(header) {
+		return i, nil
+	}
+	return 0, fmt.Errorf("column %q not found in %q", name, header)
+}
+
+// importCSV parses a CSV file with a header row.
+//
+// IDs are derived from the record content, so importing the same file twice
+// is a no-op.
+func importCSV(p string, o *importOptions) ([]Tweet, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(bufio.NewReader(f))
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	tc, err := column(header, o.timeField)
+	if err != nil {
+		return nil, err
+	}
+	pc := -1
+	if len(o.placeField) != 0 {
+		if pc, err = column(header, o.placeField); err != nil {
+			return nil, err
+		}
+	}
+	var out []Tweet
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if tc >= len(rec) {
+			line, _ := r.FieldPos(0)
+			return nil, fmt.Errorf("line %d: missing column %q", line, o.timeField)
+		}
+		t, err := o.parseTime(rec[tc])
+		if err != nil {
+			line, _ := r.FieldPos(tc)
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		place := ""
+		if pc >= 0 && pc < len(rec) {
+			place = strings.TrimSpace(rec[pc])
+		}
+		out = append(out, Tweet{CreatedAt: t, Id: hashID(strings.Join(rec, "\x00")), Place: place})
+	}
+	return out, nil
+}
+
+// importNDJSON parses a file with one JSON object per line.
+func importNDJSON(p string, o *importOptions) ([]Tweet, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 16*1024*1024)
+	var out []Tweet
+	for line := 1; s.Scan(); line++ {
+		b := s.Bytes()
+		if len(strings.TrimSpace(string(b))) == 0 {
+			continue
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		v, ok := m[o.timeField]
+		if !ok {
+			return nil, fmt.Errorf("line %d: missing field %q", line, o.timeField)
+		}
+		if _, ok := v.(float64); ok && o.timeFormat != "unix" && o.timeFormat != "unixms" {
+			return nil, fmt.Errorf("line %d: numeric timestamp; use -time-format unix or unixms", line)
+		}
+		t, err := o.parseTime(fmt.Sprint(v))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		place := ""
+		if len(o.placeField) != 0 {
+			if v, ok := m[o.placeField].(string); ok {
+				place = v
+			}
+		}
+		out = append(out, Tweet{CreatedAt: t, Id: hashID(string(b)), Place: place})
+	}
+	return out, s.Err()
+}
+
+func importEvents(args []string) error {
+	f := flag.NewFlagSet("import", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "usage: restroom import -u <user> -format <format> <file>\n")
+		f.PrintDefaults()
+	}
+	formats := make([]string, 0, len(importers))
+	for n := range importers {
+		formats = append(formats, n)
+	}
+	sort.Strings(formats)
+	o := importOptions{}
+	user := f.String("u", "", "user to import the events as")
+	format := f.String("format", "csv", "file format: "+strings.Join(formats, ", "))
+	f.StringVar(&o.timeField, "time", "timestamp", "column or field holding the timestamp")
+	f.StringVar(&o.placeField, "place", "", "column or field holding the place, optional")
+	f.StringVar(&o.timeFormat, "time-format", time.RFC3339, "Go time layout of the timestamps, or unix or unixms")
+	f.StringVar(&o.from, "from", "", "for chat exports, only import the messages of this sender name or ID")
+	registerStore(f)
+	logs := registerLog(f)
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+
+	if err := logs.apply(); err != nil {
+		return err
+	}
+	if f.NArg() != 1 {
+		return errors.New("expected exactly one file")
+	}
+	if len(*user) == 0 {
+		return errors.New("-u is required")
+	}
+	imp, ok := importers[*format]
+	if !ok {
+		return fmt.Errorf("unknown -format %q", *format)
+	}
+	tweets, err := imp(f.Arg(0), &o)
+	if err != nil {
+		return err
+	}
+	c := load()
+	defer c.save()
+	n := c.merge(*user, tweets)
+	fmt.Printf("Imported %d new events out of %d\n", n, len(tweets))
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+)
+
+// userSizer is implemented by the Stores that know the size on disk of each
+// key.
+type userSizer interface {
+	UserSize(key string) (int64, error)
+}
+
+// formatSize returns n in human readable units.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	d, e := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		d *= unit
+		e++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(d), "KMGTPE"[e])
+}
+
+// findGaps returns the gaps longer than min between the tweets in l, the
+// largest first.
+func findGaps(l []Tweet, min time.Duration) []gap {
+	times := make([]time.Time, 0, len(l))
+	for _, t := range l {
+		times = append(times, t.CreatedAt)
+	}
+	// The cache doesn't record which source fetched the tweets.
+	out := largestGaps(times, len(times), false)
+	for i := range out {
+		if out[i].duration() < min {
+			return out[:i]
+		}
+	}
+	return out
+}
+
+// cacheCmd runs the cache subcommands.
+func cacheCmd(args []string) error {
+	if len(args) != 0 && args[0] == "info" {
+		return cacheInfo(args[1:])
+	}
+	return errors.New("expected a cache command: info")
+}
+
+// cacheInfo prints statistics about each user in the cache.
+func cacheInfo(args []string) error {
+	f := flag.NewFlagSet("cache info", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "usage: restroom cache info [-u <user>]\n")
+		f.PrintDefaults()
+	}
+	user := f.String("u", "", "only print this user")
+	gap := f.String("gap", "30d", "report the periods longer than this without any tweet")
+	registerStore(f)
+	logs := registerLog(f)
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+
+	if err := logs.apply(); err != nil {
+		return err
+	}
+	if f.NArg() != 0 {
+		return errors.New("unexpected argument")
+	}
+	minGap, err := parseAge(*gap)
+	if err != nil {
+		return err
+	}
+
+	c := load()
+	keys := []string{c.resolve(*user)}
+	if len(*user) == 0 {
+		if keys, err = c.store.Users(); err != nil {
+			return err
+		}
+	}
+	sz, _ := c.store.(userSizer)
+	for _, k := range keys {
+		l := c.get(k)
+		fmt.Printf("%s: %d tweets\n", k, len(l))
+		deleted := 0
+		for _, t := range l {
+			if t.DeletedAt != nil {
+				deleted++
+			}
+		}
+		if deleted != 0 {
+			fmt.Printf("  deleted: %d\n", deleted)
+		}
+		if len(l) != 0 {
+			fmt.Printf("  from %s to %s\n", l[len(l)-1].CreatedAt.Format(time.RFC3339), l[0].CreatedAt.Format(time.RFC3339))
+		}
+		size := ""
+		if sz != nil {
+			n, err := sz.UserSize(k)
+			if err != nil {
+				return err
+			}
+			size = formatSize(n)
+		} else {
+			// Approximation, the backends don't all store the tweets as JSON.
+			b, err := json.Marshal(l)
+			if err != nil {
+				return err
+			}
+			size = "~" + formatSize(int64(len(b)))
+		}
+		fmt.Printf("  size: %s\n", size)
+		if t, ok := c.Fetched[k]; ok {
+			fmt.Printf("  fetched: %s (%s ago)\n", t.Format(time.RFC3339), time.Since(t).Round(time.Minute))
+		} else {
+			fmt.Printf("  fetched: never\n")
+		}
+		for _, g := range findGaps(l, minGap) {
+			fmt.Printf("  gap: %s\n", g)
+		}
+	}
+	return nil
+}
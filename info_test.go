@@ -0,0 +1,32 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFindGaps(t *testing.T) {
+	d := func(day int) time.Time {
+		return time.Date(2020, 1, day, 0, 0, 0, 0, time.UTC)
+	}
+	// From the most recent, as in the cache.
+	tweets := []Tweet{{CreatedAt: d(30)}, {CreatedAt: d(20)}, {CreatedAt: d(19)}, {CreatedAt: d(4)}, {CreatedAt: d(1)}}
+	data := []struct {
+		min  time.Duration
+		want []gap
+	}{
+		{10 * 24 * time.Hour, []gap{{From: d(4), To: d(19)}, {From: d(20), To: d(30)}}},
+		{15 * 24 * time.Hour, []gap{{From: d(4), To: d(19)}}},
+		{16 * 24 * time.Hour, []gap{}},
+	}
+	for i, l := range data {
+		if got := findGaps(tweets, l.min); !reflect.DeepEqual(got, l.want) {
+			t.Errorf("#%d: got %v; want %v", i, got, l.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// charsBucket and wordsBucket are the width of the buckets of the length
+	// histograms; the last bucket has the tweets at least charsMax characters
+	// or wordsMax words long.
+	charsBucket = 20
+	charsMax    = 280
+	wordsBucket = 5
+	wordsMax    = 60
+)
+
+// limit280 is when Twitter raised the limit from 140 to 280 characters.
+var limit280 = time.Date(2017, 11, 7, 0, 0, 0, 0, time.UTC)
+
+// reURL matches the links, which Twitter counts as 23 characters.
+var reURL = regexp.MustCompile(`https?://\S+`)
+
+// lengthStats is the distribution of the length of the tweets of a kind.
+type lengthStats struct {
+	Tweets int
+	// Chars is the number of tweets per 20 characters and Words per 5 words.
+	Chars []int
+	Words []int
+	// CharsEdges and WordsEdges are the lower bound of each bucket of Chars
+	// and Words.
+	CharsEdges []int
+	WordsEdges []int
+	// MedianChars, MeanChars, MedianWords and MeanWords are over all the
+	// tweets.
+	MedianChars float64
+	MeanChars   float64
+	MedianWords float64
+	MeanWords   float64
+	// AtLimit is the number of tweets reaching the character limit of the time,
+	// 140 then 280 characters.
+	AtLimit int
+}
+
+// lengthCounter measures the text of tweets, by kind.
+type lengthCounter struct {
+	chars map[string][]int
+	words map[string][]int
+	limit map[string]int
+}
+
+func newLengthCounter() *lengthCounter {
+	return &lengthCounter{chars: map[string][]int{}, words: map[string][]int{}, limit: map[string]int{}}
+}
+
+// add measures the text of t, if stored. The retweets are skipped since their
+// text isn't the user's, and the mentions starting the replies aren't
+// counted like Twitter does.
+func (l *lengthCounter) add(t *Tweet) {
+	if len(t.Text) == 0 || t.Kind == kindRetweet || strings.HasPrefix(t.Text, "RT @") {
+		return
+	}
+	k := kindOriginal
+	text := html.UnescapeString(t.Text)
+	if t.Kind == kindReply {
+		k = kindReply
+		for strings.HasPrefix(text, "@") {
+			i := strings.IndexByte(text, ' ')
+			if i == -1 {
+				text = ""
+				break
+			}
+			text = strings.TrimLeft(text[i:], " ")
+		}
+	}
+	chars := utf8.RuneCountInString(reURL.ReplaceAllString(text, "https://t.co/0123456789"))
+	l.chars[k] = append(l.chars[k], chars)
+	l.words[k] = append(l.words[k], len(strings.Fields(text)))
+	limit := 280
+	if t.CreatedAt.Before(limit280) {
+		limit = 140
+	}
+	if chars >= limit {
+		l.limit[k]++
+	}
+}
+
+// stats returns the distributions per kind, original and reply, or nil
+// without text.
+func (l *lengthCounter) stats() map[string]*lengthStats {
+	if len(l.chars) == 0 {
+		return nil
+	}
+	out := map[string]*lengthStats{}
+	for k, chars := range l.chars {
+		s := &lengthStats{Tweets: len(chars), AtLimit: l.limit[k]}
+		s.Chars, s.MedianChars, s.MeanChars = distribution(chars, charsBucket, charsMax)
+		s.Words, s.MedianWords, s.MeanWords = distribution(l.words[k], wordsBucket, wordsMax)
+		s.CharsEdges, s.WordsEdges = bucketEdges(charsBucket, charsMax), bucketEdges(wordsBucket, wordsMax)
+		out[k] = s
+	}
+	return out
+}
+
+// distribution returns the histogram of l in buckets of width up to max, the
+// median and the mean.
+func distribution(l []int, width, max int) ([]int, float64, float64) {
+	hist := make([]int, max/width+1)
+	sum := 0
+	for _, n := range l {
+		b := n / width
+		if b >= len(hist) {
+			b = len(hist) - 1
+		}
+		hist[b]++
+		sum += n
+	}
+	sort.Ints(l)
+	median := float64(l[len(l)/2])
+	if len(l)%2 == 0 {
+		median = float64(l[len(l)/2-1]+l[len(l)/2]) / 2
+	}
+	return hist, median, float64(sum) / float64(len(l))
+}
+
+// bucketEdges returns the lower bound of each bucket of distribution.
+func bucketEdges(width, max int) []int {
+	out := make([]int, max/width+1)
+	for i := range out {
+		out[i] = i * width
+	}
+	return out
+}
+
+// lengthKinds returns the kinds of the tweets whose length is known.
+func (s *stats) lengthKinds() []string {
+	var out []string
+	for _, k := range []string{kindOriginal, kindReply} {
+		if s.Lengths[k] != nil {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// bucketLabel returns the label of the bucket i of a histogram of buckets of
+// width up to max, e.g. 20-39 or 280+.
+func bucketLabel(i, width, max int) string {
+	if i*width >= max {
+		return fmt.Sprintf("%d+", max)
+	}
+	return fmt.Sprintf("%d-%d", i*width, (i+1)*width-1)
+}
+
+func (l *lengthStats) String() string {
+	return fmt.Sprintf("median %s characters (mean %.1f), %s words (mean %.1f), %s%% at the limit", formatMedian(l.MedianChars), l.MeanChars, formatMedian(l.MedianWords), l.MeanWords, percent(l.AtLimit, l.Tweets))
+}
+
+// formatMedian returns a median, which is a half when between two values.
+func formatMedian(f float64) string {
+	if f == float64(int(f)) {
+		return fmt.Sprintf("%d", int(f))
+	}
+	return fmt.Sprintf("%.1f", f)
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDistribution(t *testing.T) {
+	data := []struct {
+		l      []int
+		width  int
+		max    int
+		hist   []int
+		median float64
+		mean   float64
+	}{
+		{[]int{0}, 20, 280, []int{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, 0, 0},
+		{[]int{19, 20, 279, 280, 500}, 20, 280, []int{1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 2}, 279, 219.6},
+		{[]int{7, 1, 4, 2}, 5, 10, []int{3, 1, 0}, 3, 3.5},
+	}
+	for i, l := range data {
+		hist, median, mean := distribution(l.l, l.width, l.max)
+		if !reflect.DeepEqual(hist, l.hist) || median != l.median || mean != l.mean {
+			t.Errorf("#%d: got %v, %g, %g; want %v, %g, %g", i, hist, median, mean, l.hist, l.median, l.mean)
+		}
+	}
+}
+
+func TestBucketEdges(t *testing.T) {
+	if got, want := bucketEdges(5, 20), []int{0, 5, 10, 15, 20}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v; want %v", got, want)
+	}
+}
+
+func TestBucketLabel(t *testing.T) {
+	data := []struct {
+		i, width, max int
+		want          string
+	}{
+		{0, 20, 280, "0-19"},
+		{13, 20, 280, "260-279"},
+		{14, 20, 280, "280+"},
+		{12, 5, 60, "60+"},
+	}
+	for i, l := range data {
+		if got := bucketLabel(l.i, l.width, l.max); got != l.want {
+			t.Errorf("#%d: got %q; want %q", i, got, l.want)
+		}
+	}
+}
+
+func TestLengthCounter(t *testing.T) {
+	before := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	after := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := []struct {
+		tweet Tweet
+		kind  string
+		chars int
+		words int
+		limit bool
+	}{
+		{Tweet{Text: "hello world", CreatedAt: after}, kindOriginal, 11, 2, false},
+		{Tweet{Text: "a &amp; b", CreatedAt: after, Kind: kindQuote}, kindOriginal, 5, 3, false},
+		// A link counts as 23 characters.
+		{Tweet{Text: "see https://example.com/a/very/long/path", CreatedAt: after}, kindOriginal, 27, 2, false},
+		{Tweet{Text: "@alice @bob thanks", CreatedAt: after, Kind: kindReply}, kindReply, 6, 1, false},
+		{Tweet{Text: "@alice", CreatedAt: after, Kind: kindReply}, kindReply, 0, 0, false},
+		{Tweet{Text: strings.Repeat("é", 140), CreatedAt: before}, kindOriginal, 140, 1, true},
+		{Tweet{Text: strings.Repeat("a", 140), CreatedAt: after}, kindOriginal, 140, 1, false},
+		{Tweet{Text: strings.Repeat("a", 280), CreatedAt: after}, kindOriginal, 280, 1, true},
+	}
+	for i, l := range data {
+		c := newLengthCounter()
+		c.add(&l.tweet)
+		s := c.stats()
+		if len(s) != 1 || s[l.kind] == nil {
+			t.Errorf("#%d: got %v", i, s)
+			continue
+		}
+		got := s[l.kind]
+		if got.Tweets != 1 || got.MedianChars != float64(l.chars) || got.MedianWords != float64(l.words) || (got.AtLimit == 1) != l.limit {
+			t.Errorf("#%d: got %+v; want %d characters, %d words, limit %t", i, got, l.chars, l.words, l.limit)
+		}
+	}
+}
+
+func TestLengthCounterSkip(t *testing.T) {
+	c := newLengthCounter()
+	for _, tw := range []Tweet{
+		{},
+		{Text: "RT @alice: hi", Kind: kindRetweet},
+		// The kind of the tweets cached by older versions is unknown.
+		{Text: "RT @alice: hi"},
+	} {
+		c.add(&tw)
+	}
+	if s := c.stats(); s != nil {
+		t.Fatalf("got %v", s)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// twitterEndpoints are the API v1.1 endpoints fetching uses.
+var twitterEndpoints = map[string]bool{
+	"/favorites/list":         true,
+	"/lists/members":          true,
+	"/search/tweets":          true,
+	"/statuses/lookup":        true,
+	"/statuses/user_timeline": true,
+	"/users/show/:id":         true,
+}
+
+// showLimits is the "limits" subcommand. It prints the requests left for the
+// credential profile, both as recorded by previous runs and as reported by the
+// API, to tell whether a fetch fits in the current window.
+func showLimits(args []string) error {
+	f := flag.NewFlagSet("limits", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "usage: restroom limits [-profile <name>]\n")
+		f.PrintDefaults()
+	}
+	cred := registerCredentials(f)
+	proxy := registerProxy(f)
+	logs := registerLog(f)
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+
+	if err := logs.apply(); err != nil {
+		return err
+	}
+	if f.NArg() != 0 {
+		return errors.New("unexpected argument")
+	}
+	if err := setProxy(*proxy); err != nil {
+		return err
+	}
+	if err := cred.loadDefaults(); err != nil {
+		return err
+	}
+	fmt.Printf("Profile: %s\n", keyringAccount(cred.Profile))
+
+	// The quotas are kept per profile across runs.
+	s := sources["twitter"].new(cred).(*twitterSource)
+	names := make([]string, 0, len(s.limits))
+	for n := range s.limits {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var lines []string
+	for _, n := range names {
+		l := s.limits[n]
+		left, reset := l.status()
+		line := fmt.Sprintf("  %-40s %5d/%-5d", n, left, l.n)
+		if !reset.IsZero() {
+			line += " reset at " + reset.UTC().Format("15:04:05") + " UTC"
+		}
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+	fmt.Printf("Requests left in the %s window, as recorded by restroom:\n%s\n", s.limits[names[0]].window, strings.Join(lines, "\n"))
+
+	if !cred.appOnly() && (len(cred.Token) == 0 || len(cred.TokenSecret) == 0) {
+		fmt.Printf("No -t and -s or -bearer; the limits reported by the API are not available\n")
+		return nil
+	}
+	// https://developer.twitter.com/en/docs/twitter-api/v1/developer-utilities/rate-limit-status/api-reference/get-application-rate_limit_status
+	var r rateLimitStatus
+	v := url.Values{"resources": {"statuses,favorites,search,lists,users"}}
+	if _, err := getV1(context.Background(), cred, "/application/rate_limit_status.json", v, &r); err != nil {
+		return err
+	}
+	fmt.Printf("Requests left, as reported by the API:\n%s\n", strings.Join(r.lines(func(e string) bool { return twitterEndpoints[e] }), "\n"))
+	return nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// calendar is how the weekdays are printed in a language.
+type calendar struct {
+	// days and abbr are the names of the weekdays, starting on Sunday.
+	days [7]string
+	abbr [7]string
+	// first is the first day of the week.
+	first time.Weekday
+}
+
+// calendars are the languages supported by -lang.
+var calendars = map[string]*calendar{
+	"de": {
+		days:  [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		abbr:  [7]string{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+		first: time.Monday,
+	},
+	"en": {
+		days:  [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		abbr:  [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+		first: time.Sunday,
+	},
+	"es": {
+		days:  [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		abbr:  [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+		first: time.Monday,
+	},
+	"fr": {
+		days:  [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		abbr:  [7]string{"dim", "lun", "mar", "mer", "jeu", "ven", "sam"},
+		first: time.Monday,
+	},
+	"it": {
+		days:  [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+		abbr:  [7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+		first: time.Monday,
+	},
+	"nl": {
+		days:  [7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+		abbr:  [7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+		first: time.Monday,
+	},
+}
+
+// cal is the calendar selected with -lang and -week-start. The CSV and JSON
+// outputs are not localized so they are stable for the tools processing them.
+var cal = calendars["en"]
+
+func calendarNames() []string {
+	out := make([]string, 0, len(calendars))
+	for n := range calendars {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// setCalendar selects the calendar of lang, starting the week on weekStart if
+// not empty.
+func setCalendar(lang, weekStart string) error {
+	c := calendars[lang]
+	if c == nil {
+		return fmt.Errorf("-lang: unsupported %q; use %s", lang, strings.Join(calendarNames(), ", "))
+	}
+	cp := *c
+	switch strings.ToLower(weekStart) {
+	case "":
+	case "sunday":
+		cp.first = time.Sunday
+	case "monday":
+		cp.first = time.Monday
+	default:
+		return fmt.Errorf("-week-start: expected sunday or monday")
+	}
+	cal = &cp
+	return nil
+}
+
+// order returns the weekdays in the order they are printed.
+func (c *calendar) order() []time.Weekday {
+	out := make([]time.Weekday, 7)
+	for i := range out {
+		out[i] = (c.first + time.Weekday(i)) % 7
+	}
+	return out
+}
+
+// padLeft right-aligns s in n columns.
+func padLeft(s string, n int) string {
+	if l := utf8.RuneCountInString(s); l < n {
+		return strings.Repeat(" ", n-l) + s
+	}
+	return s
+}
+
+// maxLen returns the length in runes of the longest string of l.
+func maxLen(l []string) int {
+	n := 0
+	for _, s := range l {
+		if m := utf8.RuneCountInString(s); m > n {
+			n = m
+		}
+	}
+	return n
+}
+
+// clock12 is set with -clock 12 to label the hours 12 AM to 11 PM.
+var clock12 bool
+
+// hourLabel returns the label of the hour h, e.g. 13 or 1 PM.
+func hourLabel(h int) string {
+	if !clock12 {
+		return strconv.Itoa(h)
+	}
+	if h < 12 {
+		return strconv.Itoa(hour12(h)) + " AM"
+	}
+	return strconv.Itoa(hour12(h)) + " PM"
+}
+
+// clockLabel returns the time at the hour h, e.g. 13:00 or 1 PM.
+func clockLabel(h int) string {
+	if clock12 {
+		return hourLabel(h)
+	}
+	return strconv.Itoa(h) + ":00"
+}
+
+// hourTick returns a short label of the hour h for the axes of the charts,
+// e.g. 13 or 1p.
+func hourTick(h int) string {
+	if !clock12 {
+		return strconv.Itoa(h)
+	}
+	if h < 12 {
+		return strconv.Itoa(hour12(h)) + "a"
+	}
+	return strconv.Itoa(hour12(h)) + "p"
+}
+
+// hour12 returns the hour h on a 12-hour clock.
+func hour12(h int) int {
+	if h%12 == 0 {
+		return 12
+	}
+	return h % 12
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"golang.org/x/exp/slog"
+)
+
+func init() {
+	// Until the flags are parsed, only print the warnings.
+	slog.SetDefault(slog.New(slog.NewTextHandler(logWriter{}, &slog.HandlerOptions{Level: logLevel})))
+}
+
+// logLevel is the minimum level of the logs printed, set with -log-level.
+var logLevel = slog.LevelWarn
+
+// logOptions are the flags selecting the logs printed to stderr.
+type logOptions struct {
+	verbose bool
+	level   string
+	format  string
+}
+
+// registerLog registers the logging flags on f.
+func registerLog(f *flag.FlagSet) *logOptions {
+	o := &logOptions{}
+	f.BoolVar(&o.verbose, "v", false, "verbose output; same as -log-level debug")
+	f.StringVar(&o.level, "log-level", "warn", "minimum level of the logs printed: debug, info, warn or error")
+	f.StringVar(&o.format, "log-format", "text", "format of the logs: text, or json to process them")
+	return o
+}
+
+// apply sets up the logger once the flags are parsed.
+func (o *logOptions) apply() error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(o.level)); err != nil {
+		return errors.New("-log-level: expected debug, info, warn or error")
+	}
+	if o.verbose {
+		l = slog.LevelDebug
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	var h slog.Handler
+	switch o.format {
+	case "text":
+		h = slog.NewTextHandler(logWriter{}, opts)
+	case "json":
+		h = slog.NewJSONHandler(logWriter{}, opts)
+	default:
+		return errors.New("-log-format: expected text or json")
+	}
+	logLevel = l
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// logWriter writes the logs to stderr, clearing the fetch progress first.
+type logWriter struct{}
+
+func (logWriter) Write(b []byte) (int, error) {
+	fetchProgress.clear()
+	return os.Stderr.Write(b)
+}
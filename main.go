@@ -5,200 +5,510 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"log"
-	"net/url"
 	"os"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
-	"unicode/utf8"
 
-	"github.com/ChimeraCoder/anaconda"
+	"golang.org/x/exp/slog"
 )
 
 type Tweet struct {
 	CreatedAt time.Time
 	Id        int64
 	Place     string
+	// Text is only kept with -store-text.
+	Text string `json:",omitempty"`
+	// Source is the client used to post, e.g. "Twitter for iPhone".
+	Source string `json:",omitempty"`
+	// Geo is where the tweet was posted, when known.
+	Geo *LatLong `json:",omitempty"`
+	// Likes and Retweets are only kept with -store-engagement, as of the last
+	// time the tweet was fetched.
+	Likes    int `json:",omitempty"`
+	Retweets int `json:",omitempty"`
+	// DeletedAt is when the tweet was first found to be deleted with
+	// -check-deleted.
+	DeletedAt *time.Time `json:",omitempty"`
+	// Hashtags are without the '#', Mentions are the screen names of the
+	// users mentioned and URLs are expanded.
+	Hashtags []string `json:",omitempty"`
+	Mentions []string `json:",omitempty"`
+	URLs     []string `json:",omitempty"`
+	// Media is the number of attached photos or videos.
+	Media int `json:",omitempty"`
+	// Kind is one of the kinds below; it is empty when the source doesn't
+	// tell, or the tweet was cached by an older version.
+	Kind string `json:",omitempty"`
 }
 
+// The kinds of tweets. A reply quoting a tweet is a reply.
+const (
+	kindOriginal = "original"
+	kindReply    = "reply"
+	kindRetweet  = "retweet"
+	kindQuote    = "quote"
+	// kindUnknown is only used in the stats.
+	kindUnknown = "unknown"
+)
+
+// kinds are the kinds of tweets in the order they are reported.
+var kinds = []string{kindOriginal, kindReply, kindRetweet, kindQuote, kindUnknown}
+
+// tweetKind returns the kind of a tweet from what it refers to.
+func tweetKind(reply, retweet, quote bool) string {
+	switch {
+	case retweet:
+		return kindRetweet
+	case reply:
+		return kindReply
+	case quote:
+		return kindQuote
+	}
+	return kindOriginal
+}
+
+// hasEntities returns true if any of the entities of the tweet is set.
+func (t *Tweet) hasEntities() bool {
+	return len(t.Hashtags) != 0 || len(t.Mentions) != 0 || len(t.URLs) != 0 || t.Media != 0
+}
+
+// LatLong is a location in degrees.
+type LatLong struct {
+	Lat, Long float64
+	// Exact is false when the location is the center of the tweet's place.
+	Exact bool `json:",omitempty"`
+}
+
+// cache is the tweets cached in a Store, along with the metadata about the
+// keys.
 type cache struct {
-	Users map[string][]Tweet
+	*cacheMeta
+	store Store
 }
 
+// fatalf is used when the cache cannot be accessed, since the callers do not
+// expect an error.
+func fatalf(format string, a ...interface{}) {
+	fmt.Fprintln(os.Stderr, paint(fmt.Sprintf("restroom: "+format+".", a...), colorError, useColor(os.Stderr)))
+	os.Exit(1)
+}
+
+// load opens the Store selected with -store and -cache.
 func load() *cache {
-	c := &cache{Users: map[string][]Tweet{}}
-	f, err := os.Open("restroom.json")
+	s, err := openStore()
 	if err != nil {
-		return c
+		fatalf("%s: %v", cacheStore, err)
 	}
-	defer f.Close()
-	d := json.NewDecoder(f)
-	_ = d.Decode(c)
-	if c.Users == nil {
-		c.Users = map[string][]Tweet{}
+	m, err := s.Meta()
+	if err != nil {
+		fatalf("%s: %v", cacheStore, err)
 	}
-	return c
+	return &cache{cacheMeta: m, store: s}
 }
 
 func (c *cache) save() {
-	b, err := json.Marshal(c)
+	if err := c.store.SetMeta(c.cacheMeta); err != nil {
+		fatalf("%s: %v", cacheStore, err)
+	}
+	if err := c.store.Flush(); err != nil {
+		fatalf("%s: %v", cacheStore, err)
+	}
+}
+
+// get returns the tweets cached under key, from the most recent to the oldest.
+func (c *cache) get(key string) []Tweet {
+	l, err := c.store.LoadUser(key)
 	if err != nil {
-		log.Fatalf("json: %v", err)
-	}
-	ioutil.WriteFile("restroom.json", b, 0600)
-}
-
-func (c *cache) fetchMore(user, consumerKey, consumerSecret, token, tokenSecret string) error {
-	if len(token) == 0 || len(tokenSecret) == 0 {
-		return errors.New("both -t and -s are required. If you don't have one, visit https://apps.twitter.com/app/new to create a new token.")
-	}
-	if len(consumerKey) != 0 {
-		anaconda.SetConsumerKey(consumerKey)
-	}
-	if len(consumerSecret) != 0 {
-		anaconda.SetConsumerSecret(consumerSecret)
-	}
-	api := anaconda.NewTwitterApi(token, tokenSecret)
-	defer api.Close()
-	// The important bits of
-	// https://dev.twitter.com/rest/reference/get/statuses/user_timeline are:
-	// - "This method can only return up to 3,200 of a user’s most recent Tweets"
-	// - "count" is limited to 200.
-	// - Maximum 300 requests / 15 minutes.
-	v := url.Values{
-		"contributor_details": {"0"},
-		"count":               {"200"},
-		"exclude_replies":     {"0"},
-		"trim_user":           {"1"},
-		"include_rts":         {"1"},
-		"screen_name":         {user},
-	}
-	first := true
-	ids := map[int64]struct{}{}
-	for i := 0; i < 10; i++ {
-		if len(c.Users[user]) != 0 {
-			// Assumes tweets are in order.
-			m := strconv.FormatInt(c.Users[user][len(c.Users[user])-1].Id-1, 10)
-			log.Printf("using max_id %s", m)
-			v["max_id"] = []string{m}
-		}
-		log.Printf("Fetching")
-		timeline, err := api.GetUserTimeline(v)
-		log.Printf("Retrieved %d tweets", len(timeline))
-		if err != nil && first {
-			return err
-		}
-		if len(timeline) == 0 || err != nil {
-			break
-		}
-		first = false
-		for _, tweet := range timeline {
-			if _, ok := ids[tweet.Id]; !ok {
-				ids[tweet.Id] = struct{}{}
-				t, err := tweet.CreatedAtTime()
-				if err != nil {
-					log.Fatalf("time: %v", err)
-				}
-				c.Users[user] = append(c.Users[user], Tweet{t, tweet.Id, tweet.Place.Name})
+		fatalf("%s: %v", cacheStore, err)
+	}
+	return l
+}
+
+// resolve returns the key the data for key is stored under.
+func (c *cache) resolve(key string) string {
+	if k, ok := c.Aliases[key]; ok {
+		return k
+	}
+	return key
+}
+
+// alias records that key is now stored under canonical, moving the tweets
+// already cached under key.
+func (c *cache) alias(key, canonical string) {
+	if key == canonical || c.Aliases[key] == canonical {
+		return
+	}
+	slog.Info("Moved cache entry", "from", key, "to", canonical)
+	c.Aliases[key] = canonical
+	if t := c.get(key); len(t) != 0 {
+		// Keep everything already cached, regardless of -store-text.
+		if err := c.store.AppendTweets(canonical, t); err != nil {
+			fatalf("%s: %v", cacheStore, err)
+		}
+		if err := c.store.RemoveUser(key); err != nil {
+			fatalf("%s: %v", cacheStore, err)
+		}
+	}
+	if t, ok := c.Fetched[key]; ok {
+		if t.After(c.Fetched[canonical]) {
+			c.Fetched[canonical] = t
+		}
+		delete(c.Fetched, key)
+	}
+	if cur, ok := c.Cursors[key]; ok {
+		c.Cursors[canonical] = cur
+		delete(c.Cursors, key)
+	}
+}
+
+// merge adds the tweets not already present for key. With -store-engagement,
+// the counts of the tweets already present are updated. The entities, kind,
+// client and location of the tweets cached before they were kept are filled
+// in. Returns the number of tweets added.
+func (c *cache) merge(key string, tweets []Tweet) int {
+	ids := map[int64]Tweet{}
+	for _, t := range c.get(key) {
+		ids[t.Id] = t
+	}
+	var changed []Tweet
+	n := 0
+	for _, t := range tweets {
+		if !storeText {
+			t.Text = ""
+		}
+		if !storeEngagement {
+			t.Likes = 0
+			t.Retweets = 0
+		}
+		if e, ok := ids[t.Id]; ok {
+			update := false
+			if storeEngagement && (e.Likes != t.Likes || e.Retweets != t.Retweets) {
+				e.Likes = t.Likes
+				e.Retweets = t.Retweets
+				update = true
 			}
+			if !e.hasEntities() && t.hasEntities() {
+				e.Hashtags, e.Mentions, e.URLs, e.Media = t.Hashtags, t.Mentions, t.URLs, t.Media
+				update = true
+			}
+			if len(e.Kind) == 0 && len(t.Kind) != 0 {
+				e.Kind = t.Kind
+				update = true
+			}
+			if len(e.Source) == 0 && len(t.Source) != 0 {
+				e.Source = t.Source
+				update = true
+			}
+			if e.Geo == nil && t.Geo != nil {
+				e.Geo = t.Geo
+				update = true
+			}
+			if !update {
+				continue
+			}
+			t = e
+		} else {
+			n++
+		}
+		ids[t.Id] = t
+		changed = append(changed, t)
+	}
+	if len(changed) != 0 {
+		if err := c.store.AppendTweets(key, changed); err != nil {
+			fatalf("%s: %v", cacheStore, err)
 		}
 	}
-	return nil
+	return n
 }
 
-func mainImpl() error {
-	user := flag.String("u", "", "user to query")
-	verbose := flag.Bool("v", false, "verbose output")
-	consumerKey := flag.String("k", "", "consumer key")
-	consumerSecret := flag.String("c", "", "consumer secret")
-	token := flag.String("t", "", "access token")
-	tokenSecret := flag.String("s", "", "access token secret")
-	flag.Parse()
-
-	if !*verbose {
-		log.SetOutput(ioutil.Discard)
-	}
-	if flag.NArg() != 0 {
-		return errors.New("unexpected argument")
+// markDeleted records the tweets cached under key that are not in existing as
+// deleted, as returned by Verifier.Existing. Returns the number of tweets newly
+// found deleted.
+func (c *cache) markDeleted(key string, existing map[int64]bool) (int, error) {
+	l := c.get(key)
+	now := time.Now().UTC()
+	var changed []Tweet
+	n := 0
+	for _, t := range l {
+		if existing[t.Id] {
+			if t.DeletedAt == nil {
+				continue
+			}
+			// The account was likely protected or suspended temporarily.
+			t.DeletedAt = nil
+		} else {
+			if t.DeletedAt != nil {
+				continue
+			}
+			t.DeletedAt = &now
+			n++
+		}
+		changed = append(changed, t)
 	}
-	if len(*user) == 0 {
-		return errors.New("-u is required")
+	if len(changed) != 0 {
+		if err := c.store.AppendTweets(key, changed); err != nil {
+			return 0, err
+		}
 	}
+	return n, nil
+}
 
-	c := load()
-	defer c.save()
-	if len(*token) != 0 {
-		if err := c.fetchMore(*user, *consumerKey, *consumerSecret, *token, *tokenSecret); err != nil {
-			return err
-		}
-	}
-	hours := [24]int{}
-	weekdays := [7]int{}
-	placesMap := map[string]int{}
-	places := []string{}
-	placesLen := 0
-	for _, t := range c.Users[*user] {
-		//fmt.Printf("%s %s\n", t.CreatedAt.Format("2006-01-02 15:04:05"), t.Place)
-		hours[t.CreatedAt.Hour()]++
-		weekdays[t.CreatedAt.Weekday()]++
-		if len(t.Place) != 0 {
-			if _, ok := placesMap[t.Place]; !ok {
-				placesMap[t.Place] = 0
-				if l := utf8.RuneCountInString(t.Place); l > placesLen {
-					placesLen = l
-				}
-				places = append(places, t.Place)
+// sortTweets sorts l from the most recent to the oldest tweet.
+func sortTweets(l []Tweet) {
+	sort.SliceStable(l, func(i, j int) bool {
+		if l[i].CreatedAt.Equal(l[j].CreatedAt) {
+			return l[i].Id > l[j].Id
+		}
+		return l[i].CreatedAt.After(l[j].CreatedAt)
+	})
+}
+
+// readUsers reads a file with one user per line. Empty lines and lines
+// starting with # are ignored.
+func readUsers(p string) ([]string, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, l := range strings.Split(string(b), "\n") {
+		if l = strings.TrimSpace(l); len(l) != 0 && l[0] != '#' {
+			out = append(out, strings.TrimPrefix(l, "@"))
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%s: no user found", p)
+	}
+	return out, nil
+}
+
+// errInterrupted is returned when the fetch is interrupted with Ctrl-C.
+var errInterrupted = errors.New("interrupted; the progress was saved")
+
+// targets are the flags selecting the cache entries to fetch or report on.
+type targets struct {
+	users     []string
+	query     string
+	list      string
+	usersFile string
+	source    string
+}
+
+// registerTargets registers the flags selecting the users or query on f,
+// along with the flags of the sources. -list is only registered when withList
+// is set since the members can only be retrieved from the API.
+func registerTargets(f *flag.FlagSet, withList bool) *targets {
+	t := &targets{}
+	f.Func("u", "user to query; can be repeated or a comma separated list", func(s string) error {
+		for _, u := range strings.Split(s, ",") {
+			if u = strings.TrimSpace(u); len(u) != 0 {
+				t.users = append(t.users, u)
 			}
-			placesMap[t.Place]++
 		}
+		return nil
+	})
+	f.StringVar(&t.query, "q", "", "search query to collect and report on instead of -u")
+	if withList {
+		f.StringVar(&t.list, "list", "", "owner/slug of a list whose members are fetched and reported on together")
 	}
-	sort.Strings(places)
-	fmt.Printf("Processed %d tweets\n", len(c.Users[*user]))
-	fmt.Printf("Favorite hour in UTC:\n")
-	max := 1
-	barChar := "*"
-	barMaxLen := 10
-	for _, s := range hours {
-		if max < s {
-			max = s
+	f.StringVar(&t.usersFile, "users-file", "", "file with one user per line to fetch and report on together")
+	f.StringVar(&t.source, "source", "twitter", "source to query: "+strings.Join(sourceNames(), ", "))
+	for _, n := range sourceNames() {
+		if fl := sources[n].flags; fl != nil {
+			fl(f)
 		}
 	}
-	for i, s := range hours {
-		fmt.Printf("  %2d: %3d %s\n", i, s, strings.Repeat(barChar, (barMaxLen*s+max/2)/max))
+	return t
+}
+
+// sourceDef verifies that exactly one target is selected and returns the
+// source selected with -source.
+func (t *targets) sourceDef(withList bool) (sourceDef, error) {
+	n := 0
+	if len(t.users) != 0 {
+		n++
 	}
-	fmt.Printf("Favorite weekday in UTC:\n")
-	max = 1
-	for _, s := range weekdays {
-		if max < s {
-			max = s
+	for _, s := range []string{t.query, t.list, t.usersFile} {
+		if len(s) != 0 {
+			n++
 		}
 	}
-	for i, s := range weekdays {
-		fmt.Printf("  %9s: %3d %s\n", time.Weekday(i), s, strings.Repeat(barChar, (barMaxLen*s+max/2)/max))
+	if n != 1 {
+		if withList {
+			return sourceDef{}, errors.New("one of -u, -q, -list or -users-file is required")
+		}
+		return sourceDef{}, errors.New("one of -u, -q or -users-file is required")
+	}
+	def, ok := sources[t.source]
+	if !ok {
+		return sourceDef{}, fmt.Errorf("unknown -source %q", t.source)
+	}
+	return def, nil
+}
+
+// keys returns the cache keys of the targets as stored by the previous
+// fetches, without querying the source.
+func (t *targets) keys(c *cache, src Source) ([]string, error) {
+	if len(t.query) != 0 {
+		return []string{"q:" + t.query}, nil
+	}
+	users := t.users
+	if len(t.usersFile) != 0 {
+		var err error
+		if users, err = readUsers(t.usersFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(t.list) != 0 {
+		return nil, errors.New("the members of -list can only be retrieved from the API")
+	}
+	out := make([]string, 0, len(users))
+	for _, u := range users {
+		out = append(out, c.resolve(src.Key(u)))
+	}
+	return out, nil
+}
+
+// subcommand is a command selected by the first argument.
+type subcommand struct {
+	run  func(args []string) error
+	help string
+}
+
+// subcommands are selected with the first argument.
+var subcommands map[string]subcommand
+
+func init() {
+	// Initialized here since help refers to subcommands.
+	subcommands = map[string]subcommand{
+		"auth":           {authorize, "authorize restroom and save the credentials"},
+		"cache":          {cacheCmd, "inspect the cache"},
+		"completion":     {completionCmd, "print the shell completion script for bash, zsh or fish"},
+		"export":         {exportCmd, "print the cached posts as JSON or CSV"},
+		"fetch":          {fetchCmd, "fetch the posts of users or a search query into the cache"},
+		"help":           {help, "print the help of a command"},
+		"import":         {importEvents, "import timestamped events from a CSV, JSON, Telegram or Discord export"},
+		"import-archive": {importArchive, "import a Twitter archive"},
+		"limits":         {showLimits, "print the API quota left"},
+		"merge":          {mergeCaches, "merge caches from several machines"},
+		"prune":          {pruneCache, "remove the tweets older than a retention window"},
+		"report":         {reportCmd, "write the stats as a HTML page with charts"},
+		"stats":          {statsCmd, "print when the users post, from the cache"},
+		"stream":         {streamTweets, "add the new tweets to the cache as they are posted"},
+		"tui":            {tuiCmd, "explore the stats of the cached users interactively"},
+		"users":          {usersCmd, "list or remove the users in the cache"},
+		"version":        {versionCmd, "print the version of restroom"},
+		"watch":          {watchCmd, "fetch and print the stats periodically"},
+	}
+}
+
+// usage prints the commands.
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: restroom <command> [flags]\n\nCommands:\n")
+	names := make([]string, 0, len(subcommands))
+	for n := range subcommands {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		fmt.Fprintf(os.Stderr, "  %-15s %s\n", n, subcommands[n].help)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'restroom <command> -h' for the flags of a command. Without a command,\nrestroom fetches then prints the stats, accepting the flags of both. Run\n'restroom help config' to set the default flag values.\n")
+}
+
+// help prints the help of a command.
+func help(args []string) error {
+	if len(args) == 0 {
+		usage()
+		return nil
+	}
+	if len(args) != 1 {
+		return errors.New("expected a single command")
+	}
+	switch args[0] {
+	case "help":
+		usage()
+		return nil
+	case "config":
+		configHelp()
+		return nil
+	}
+	cmd, ok := subcommands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	return cmd.run([]string{"-h"})
+}
+
+// fetchAndReport is run without a command, for compatibility with the
+// versions before the commands were split.
+func fetchAndReport(args []string) error {
+	f := flag.NewFlagSet("restroom", flag.ExitOnError)
+	f.Usage = usage
+	o := registerFetch(f)
+	so := registerStats(f, true)
+	offline := f.Bool("offline", false, "report from the cache without any network access, even with credentials")
+	registerColor(f)
+	registerStore(f)
+	logs := registerLog(f)
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+
+	if err := logs.apply(); err != nil {
+		return err
 	}
-	fmt.Printf("Favorite places:\n")
-	max = 1
-	for _, p := range places {
-		if max < placesMap[p] {
-			max = placesMap[p]
+	if f.NArg() != 0 {
+		return errors.New("unexpected argument")
+	}
+	if err := so.parse(); err != nil {
+		return err
+	}
+	c := load()
+	defer c.save()
+	var keys []string
+	var err error
+	if *offline {
+		goOffline()
+		var def sourceDef
+		if def, err = o.sourceDef(false); err == nil {
+			keys, err = o.keys(c, def.new(o.cred))
 		}
+	} else {
+		keys, err = o.fetch(c)
+	}
+	if err != nil {
+		return err
 	}
-	for _, p := range places {
-		fmt.Printf("  %*s: %d %s\n", placesLen, p, placesMap[p], strings.Repeat(barChar, (barMaxLen*placesMap[p]+max/2)/max))
+	return so.report(c, o.targets, keys)
+}
+
+func mainImpl() error {
+	if len(os.Args) > 1 {
+		if os.Args[1] == "-version" || os.Args[1] == "--version" {
+			return versionCmd(os.Args[2:])
+		}
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			return cmd.run(os.Args[2:])
+		}
+		if !strings.HasPrefix(os.Args[1], "-") {
+			usage()
+			return fmt.Errorf("unknown command %q", os.Args[1])
+		}
+	} else {
+		usage()
+		return errors.New("expected a command")
 	}
-	return nil
+	return fetchAndReport(os.Args[1:])
 }
 
 func main() {
 	if err := mainImpl(); err != nil {
-		fmt.Fprintf(os.Stderr, "restroom: %s.\n", err)
-		os.Exit(1)
+		fatalf("%s", err)
 	}
 }
@@ -0,0 +1,143 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// parseAcct splits a Mastodon account "@user@instance.social" into its user
+// and instance.
+func parseAcct(acct string) (string, string, error) {
+	parts := strings.Split(strings.TrimPrefix(acct, "@"), "@")
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return "", "", fmt.Errorf("invalid mastodon account %q; expected @user@instance", acct)
+	}
+	return parts[0], parts[1], nil
+}
+
+type mastodonStatus struct {
+	ID          string    `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	InReplyToID *string   `json:"in_reply_to_id"`
+	Reblog      *struct{} `json:"reblog"`
+	Application *struct {
+		Name string `json:"name"`
+	} `json:"application"`
+}
+
+func init() {
+	registerSource("mastodon", sourceDef{
+		new: func(cred *credentials) Source { return &mastodonSource{token: cred.Token} },
+	})
+}
+
+// mastodonSource fetches the statuses of a Mastodon account.
+//
+// token is optional; it is only needed on instances that do not expose public
+// timelines without authentication.
+type mastodonSource struct {
+	token string
+}
+
+// Key keeps the cache keys distinct from twitter screen names.
+func (m *mastodonSource) Key(acct string) string {
+	return "mastodon:" + strings.TrimPrefix(acct, "@")
+}
+
+func (m *mastodonSource) Fetch(ctx context.Context, acct string, cached []Tweet) ([]Tweet, error) {
+	user, instance, err := parseAcct(acct)
+	if err != nil {
+		return nil, err
+	}
+	base := "https://" + instance + "/api/v1/accounts/"
+	var a struct {
+		ID string `json:"id"`
+	}
+	if err := getJSON(ctx, base+"lookup?"+url.Values{"acct": {user}}.Encode(), m.token, &a); err != nil {
+		return nil, err
+	}
+	if len(a.ID) == 0 {
+		return nil, errors.New("account not found")
+	}
+	slog.Debug("Resolved account", "account", acct, "id", a.ID)
+	// https://docs.joinmastodon.org/methods/accounts/#statuses
+	// - "limit" is limited to 40.
+	// - Maximum 300 requests / 5 minutes.
+	u := base + a.ID + "/statuses?"
+	v := url.Values{"limit": {strconv.Itoa(pageLen(40))}}
+	var out []Tweet
+	if first, ok := newest(cached); ok {
+		// Pick up the statuses posted since the last run first. min_id pages
+		// forward from the newest status cached, so an interrupted pass
+		// resumes from what was saved.
+		for i := 0; i < pageCount(50) && !enough(len(out)); i++ {
+			mid := strconv.FormatInt(first.Id, 10)
+			slog.Debug("Using min_id", "min_id", mid)
+			v.Set("min_id", mid)
+			l, err := m.statuses(ctx, u, v)
+			out = append(out, l...)
+			if err != nil {
+				return out, err
+			}
+			if len(l) == 0 {
+				break
+			}
+			// The statuses are from the most recent, whatever the direction.
+			first = l[0]
+		}
+		v.Del("min_id")
+	}
+	last, ok := oldest(cached)
+	for i := 0; i < pageCount(50) && !enough(len(out)); i++ {
+		if ok {
+			mid := strconv.FormatInt(last.Id, 10)
+			slog.Debug("Using max_id", "max_id", mid)
+			v.Set("max_id", mid)
+		}
+		l, err := m.statuses(ctx, u, v)
+		out = append(out, l...)
+		if err != nil || len(l) == 0 {
+			return out, err
+		}
+		// Assumes statuses are in order.
+		last, ok = l[len(l)-1], true
+	}
+	return out, nil
+}
+
+// statuses returns a page of the statuses at u matching v.
+func (m *mastodonSource) statuses(ctx context.Context, u string, v url.Values) ([]Tweet, error) {
+	slog.Debug("Fetching")
+	var statuses []mastodonStatus
+	if err := getJSON(ctx, u+v.Encode(), m.token, &statuses); err != nil {
+		// The transient errors were already retried.
+		return nil, err
+	}
+	slog.Debug("Retrieved statuses", "count", len(statuses))
+	out := make([]Tweet, 0, len(statuses))
+	for _, s := range statuses {
+		id, err := strconv.ParseInt(s.ID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status id %q: %w", s.ID, err)
+		}
+		t := Tweet{CreatedAt: s.CreatedAt, Id: id, Kind: tweetKind(s.InReplyToID != nil, s.Reblog != nil, false)}
+		// The instances only expose it on the statuses of the account
+		// authenticated with -token.
+		if s.Application != nil {
+			t.Source = s.Application.Name
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"golang.org/x/exp/slog"
+)
+
+// mergeTweet returns a with the fields it lacks filled from b, which is the
+// same tweet fetched at another time or on another machine.
+func mergeTweet(a, b Tweet) Tweet {
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = b.CreatedAt
+	}
+	if len(a.Place) == 0 {
+		a.Place = b.Place
+	}
+	if len(a.Text) == 0 {
+		a.Text = b.Text
+	}
+	if len(a.Source) == 0 {
+		a.Source = b.Source
+	}
+	if len(a.Kind) == 0 {
+		a.Kind = b.Kind
+	}
+	if a.Geo == nil || (!a.Geo.Exact && b.Geo != nil && b.Geo.Exact) {
+		a.Geo = b.Geo
+	}
+	if b.DeletedAt != nil && (a.DeletedAt == nil || b.DeletedAt.Before(*a.DeletedAt)) {
+		a.DeletedAt = b.DeletedAt
+	}
+	if !a.hasEntities() {
+		a.Hashtags, a.Mentions, a.URLs, a.Media = b.Hashtags, b.Mentions, b.URLs, b.Media
+	}
+	// The counts only grow, the largest is the most recent.
+	if b.Likes > a.Likes {
+		a.Likes = b.Likes
+	}
+	if b.Retweets > a.Retweets {
+		a.Retweets = b.Retweets
+	}
+	return a
+}
+
+// mergeStores merges the tweets and metadata of src into dst.
+func mergeStores(dst, src Store) error {
+	keys, err := src.Users()
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		l, err := src.LoadUser(k)
+		if err != nil {
+			return err
+		}
+		existing, err := dst.LoadUser(k)
+		if err != nil {
+			return err
+		}
+		ids := make(map[int64]Tweet, len(existing))
+		for _, t := range existing {
+			ids[t.Id] = t
+		}
+		for i, t := range l {
+			if e, ok := ids[t.Id]; ok {
+				l[i] = mergeTweet(e, t)
+			}
+		}
+		if err := dst.AppendTweets(k, l); err != nil {
+			return err
+		}
+	}
+	m, err := src.Meta()
+	if err != nil {
+		return err
+	}
+	d, err := dst.Meta()
+	if err != nil {
+		return err
+	}
+	for k, t := range m.Fetched {
+		if t.After(d.Fetched[k]) {
+			d.Fetched[k] = t
+		}
+	}
+	for k, v := range m.Aliases {
+		if _, ok := d.Aliases[k]; !ok {
+			d.Aliases[k] = v
+		}
+	}
+	for k, v := range m.Timezones {
+		if _, ok := d.Timezones[k]; !ok {
+			d.Timezones[k] = v
+		}
+	}
+	return dst.SetMeta(d)
+}
+
+// mergeCaches merges JSON caches, e.g. fetched on different machines.
+func mergeCaches(args []string) error {
+	f := flag.NewFlagSet("merge", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "usage: restroom merge <a.json> <b.json>... -o <merged.json>\n")
+		f.PrintDefaults()
+	}
+	out := f.String("o", "", "JSON cache to write; its content, if any, is kept and merged")
+	f.BoolVar(&encryptCache, "encrypt", false, "encrypt -o with the passphrase in $RESTROOM_PASSPHRASE or typed in")
+	logs := registerLog(f)
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+	// The flags may also follow the caches.
+	var files []string
+	for f.NArg() != 0 {
+		files = append(files, f.Arg(0))
+		f.Parse(f.Args()[1:])
+	}
+
+	if err := logs.apply(); err != nil {
+		return err
+	}
+	if len(*out) == 0 {
+		return errors.New("-o is required")
+	}
+	if len(files) == 0 {
+		return errors.New("expected at least one cache to merge")
+	}
+	dst, err := openJSONStore(*out)
+	if err != nil {
+		return err
+	}
+	for _, p := range files {
+		if _, err := os.Stat(p); err != nil {
+			return err
+		}
+		src, err := openJSONStore(p)
+		if err != nil {
+			return err
+		}
+		slog.Info("Merging", "cache", p)
+		if err := mergeStores(dst, src); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+	}
+	if err := dst.Flush(); err != nil {
+		return err
+	}
+	n := 0
+	for _, l := range dst.users {
+		n += len(l)
+	}
+	fmt.Printf("Merged %d users and %d tweets into %s\n", len(dst.users), n, *out)
+	return nil
+}
@@ -0,0 +1,297 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/exp/slog"
+)
+
+// cacheVersion is the version of the cache format. Increment it and add a
+// migration to each backend when the format changes, e.g. a field is added to
+// Tweet.
+const cacheVersion = 11
+
+// jsonMigration upgrades restroom.json from a version to the next one. The
+// steps left nil have nothing to do.
+type jsonMigration struct {
+	// tweet upgrades a tweet as it is in the file, before it is decoded into
+	// Tweet, so it still sees the fields renamed or removed since.
+	tweet func(t map[string]json.RawMessage) error
+	// file upgrades the decoded file, e.g. its metadata.
+	file func(f *jsonFile) error
+}
+
+// jsonMigrations upgrade restroom.json from the version of their index to the
+// next one.
+var jsonMigrations = []jsonMigration{
+	// 0: Before versioning; the format is the same.
+	{},
+	// 1: Tweet.Text is optional.
+	{},
+	// 2: Tweet.Source is optional.
+	{},
+	// 3: Tweet.Geo is optional.
+	{},
+	// 4: Tweet.Likes and Tweet.Retweets are optional.
+	{},
+	// 5: Tweet.DeletedAt is optional.
+	{},
+	// 6: Cursors is optional.
+	{},
+	// 7: Tweet.Hashtags, Tweet.Mentions, Tweet.URLs and Tweet.Media are
+	// optional.
+	{},
+	// 8: Timezones is optional.
+	{},
+	// 9: Restroom is optional.
+	{},
+	// 10: Tweet.Kind is optional.
+	{},
+}
+
+// sqliteMigrations upgrade the SQLite database from the version of their
+// index, stored as PRAGMA user_version, to the next one.
+var sqliteMigrations = []string{
+	// 0: Empty database.
+	`
+CREATE TABLE IF NOT EXISTS tweets (
+	key        TEXT    NOT NULL,
+	id         INTEGER NOT NULL,
+	created_at TEXT    NOT NULL,
+	place      TEXT    NOT NULL DEFAULT '',
+	PRIMARY KEY (key, id)
+) WITHOUT ROWID;
+CREATE TABLE IF NOT EXISTS fetched (
+	key TEXT PRIMARY KEY,
+	at  TEXT NOT NULL
+) WITHOUT ROWID;
+CREATE TABLE IF NOT EXISTS aliases (
+	key       TEXT PRIMARY KEY,
+	canonical TEXT NOT NULL
+) WITHOUT ROWID;
+`,
+	// 1: Add Tweet.Text.
+	`ALTER TABLE tweets ADD COLUMN text TEXT NOT NULL DEFAULT '';`,
+	// 2: Add Tweet.Source.
+	`ALTER TABLE tweets ADD COLUMN source TEXT NOT NULL DEFAULT '';`,
+	// 3: Add Tweet.Geo.
+	`
+ALTER TABLE tweets ADD COLUMN lat REAL;
+ALTER TABLE tweets ADD COLUMN long REAL;
+ALTER TABLE tweets ADD COLUMN exact INTEGER NOT NULL DEFAULT 0;
+`,
+	// 4: Add Tweet.Likes and Tweet.Retweets.
+	`
+ALTER TABLE tweets ADD COLUMN likes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE tweets ADD COLUMN retweets INTEGER NOT NULL DEFAULT 0;
+`,
+	// 5: Add Tweet.DeletedAt.
+	`ALTER TABLE tweets ADD COLUMN deleted_at TEXT;`,
+	// 6: Add the cursors.
+	`
+CREATE TABLE cursors (
+	key    TEXT PRIMARY KEY,
+	cursor TEXT NOT NULL
+) WITHOUT ROWID;
+`,
+	// 7: Add the entities. The lists are space separated.
+	`
+ALTER TABLE tweets ADD COLUMN hashtags TEXT NOT NULL DEFAULT '';
+ALTER TABLE tweets ADD COLUMN mentions TEXT NOT NULL DEFAULT '';
+ALTER TABLE tweets ADD COLUMN urls TEXT NOT NULL DEFAULT '';
+ALTER TABLE tweets ADD COLUMN media INTEGER NOT NULL DEFAULT 0;
+`,
+	// 8: Add the timezones.
+	`
+CREATE TABLE timezones (
+	key TEXT PRIMARY KEY,
+	tz  TEXT NOT NULL
+) WITHOUT ROWID;
+`,
+	// 9: Add the information about the database, like the version of restroom
+	// that last wrote it.
+	`
+CREATE TABLE info (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+) WITHOUT ROWID;
+`,
+	// 10: Add Tweet.Kind.
+	`ALTER TABLE tweets ADD COLUMN kind TEXT NOT NULL DEFAULT '';`,
+}
+
+// boltMigrations upgrade the bbolt database from the version of their index,
+// stored in the "version" key of the "meta" bucket, to the next one.
+var boltMigrations = []func(tx *bolt.Tx) error{
+	// 0: Empty database.
+	func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{boltUsers, boltFetched, boltAliases} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 1: Tweet.Text is optional in the JSON values.
+	func(tx *bolt.Tx) error { return nil },
+	// 2: Tweet.Source is optional in the JSON values.
+	func(tx *bolt.Tx) error { return nil },
+	// 3: Tweet.Geo is optional in the JSON values.
+	func(tx *bolt.Tx) error { return nil },
+	// 4: Tweet.Likes and Tweet.Retweets are optional in the JSON values.
+	func(tx *bolt.Tx) error { return nil },
+	// 5: Tweet.DeletedAt is optional in the JSON values.
+	func(tx *bolt.Tx) error { return nil },
+	// 6: Add the cursors.
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltCursors)
+		return err
+	},
+	// 7: The entities are optional in the JSON values.
+	func(tx *bolt.Tx) error { return nil },
+	// 8: Add the timezones.
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltTimezones)
+		return err
+	},
+	// 9: The "restroom" key of the "meta" bucket is optional.
+	func(tx *bolt.Tx) error { return nil },
+	// 10: Tweet.Kind is optional in the JSON values.
+	func(tx *bolt.Tx) error { return nil },
+}
+
+// errNewerCache is returned when the cache was written by a newer version.
+func errNewerCache(v int) error {
+	return fmt.Errorf("the cache has version %d but this restroom only supports up to %d; upgrade restroom", v, cacheVersion)
+}
+
+// migrateJSON upgrades a decoded restroom.json in place. Its tweets were
+// upgraded by decodeTweets.
+func migrateJSON(f *jsonFile) error {
+	if f.Version > cacheVersion {
+		return errNewerCache(f.Version)
+	}
+	for ; f.Version < cacheVersion; f.Version++ {
+		slog.Info("Upgrading the cache", "version", f.Version)
+		if m := jsonMigrations[f.Version].file; m != nil {
+			if err := m(f); err != nil {
+				return fmt.Errorf("upgrading from version %d: %w", f.Version, err)
+			}
+		}
+	}
+	return nil
+}
+
+// decodeTweets decodes the tweets of a user of restroom.json at version v,
+// upgrading them first if any migration needs to.
+func decodeTweets(d *json.Decoder, v int) ([]Tweet, error) {
+	var l []Tweet
+	if v >= cacheVersion || !tweetMigrations(v) {
+		err := d.Decode(&l)
+		return l, err
+	}
+	var raw []map[string]json.RawMessage
+	if err := d.Decode(&raw); err != nil {
+		return nil, err
+	}
+	if err := migrateTweets(raw, v); err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &l)
+	return l, err
+}
+
+// tweetMigrations returns true if a migration from version v changes the
+// tweets.
+func tweetMigrations(v int) bool {
+	for _, m := range jsonMigrations[v:] {
+		if m.tweet != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateTweets upgrades tweets as they are in restroom.json at version v.
+func migrateTweets(tweets []map[string]json.RawMessage, v int) error {
+	for ; v < cacheVersion; v++ {
+		m := jsonMigrations[v].tweet
+		if m == nil {
+			continue
+		}
+		for _, t := range tweets {
+			if err := m(t); err != nil {
+				return fmt.Errorf("upgrading from version %d: %w", v, err)
+			}
+		}
+	}
+	return nil
+}
+
+// migrateSQLite upgrades the SQLite database in a transaction.
+func migrateSQLite(db *sql.DB) error {
+	v := 0
+	if err := db.QueryRow("PRAGMA user_version").Scan(&v); err != nil {
+		return err
+	}
+	if v > cacheVersion {
+		return errNewerCache(v)
+	}
+	if v == cacheVersion {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for ; v < cacheVersion; v++ {
+		slog.Info("Upgrading the cache", "version", v)
+		if _, err := tx.Exec(sqliteMigrations[v]); err != nil {
+			return fmt.Errorf("upgrading from version %d: %w", v, err)
+		}
+	}
+	// PRAGMA doesn't support parameters.
+	if _, err := tx.Exec("PRAGMA user_version = " + strconv.Itoa(cacheVersion)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrateBolt upgrades the bbolt database in a transaction.
+func migrateBolt(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists([]byte("meta"))
+		if err != nil {
+			return err
+		}
+		v := 0
+		if b := meta.Get([]byte("version")); b != nil {
+			if v, err = strconv.Atoi(string(b)); err != nil {
+				return err
+			}
+		}
+		if v > cacheVersion {
+			return errNewerCache(v)
+		}
+		for ; v < cacheVersion; v++ {
+			slog.Info("Upgrading the cache", "version", v)
+			if err := boltMigrations[v](tx); err != nil {
+				return fmt.Errorf("upgrading from version %d: %w", v, err)
+			}
+		}
+		return meta.Put([]byte("version"), []byte(strconv.Itoa(cacheVersion)))
+	})
+}
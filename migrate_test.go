@@ -0,0 +1,183 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMigrateJSON(t *testing.T) {
+	created := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	deleted := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	// Each file has what its version can hold.
+	data := []struct {
+		file  string
+		tweet Tweet
+		meta  cacheMeta
+	}{
+		{
+			`{"Users":{"a":[{"CreatedAt":"2017-03-04T05:06:07Z","Id":1,"Place":"Paris"}]},"Fetched":{"a":"2018-01-02T03:04:05Z"}}`,
+			Tweet{CreatedAt: created, Id: 1, Place: "Paris"},
+			cacheMeta{Fetched: map[string]time.Time{"a": deleted}},
+		},
+		{
+			`{"Version":1,"Users":{"a":[{"CreatedAt":"2017-03-04T05:06:07Z","Id":1,"Place":"","Text":"hi"}]},"Aliases":{"b":"a"}}`,
+			Tweet{CreatedAt: created, Id: 1, Text: "hi"},
+			cacheMeta{Aliases: map[string]string{"b": "a"}},
+		},
+		{
+			`{"Version":2,"Users":{"a":[{"CreatedAt":"2017-03-04T05:06:07Z","Id":1,"Place":"","Text":"hi","Source":"web"}]}}`,
+			Tweet{CreatedAt: created, Id: 1, Text: "hi", Source: "web"},
+			cacheMeta{},
+		},
+		{
+			`{"Version":3,"Users":{"a":[{"CreatedAt":"2017-03-04T05:06:07Z","Id":1,"Place":"","Geo":{"Lat":1.5,"Long":2.5,"Exact":true}}]}}`,
+			Tweet{CreatedAt: created, Id: 1, Geo: &LatLong{Lat: 1.5, Long: 2.5, Exact: true}},
+			cacheMeta{},
+		},
+		{
+			`{"Version":4,"Users":{"a":[{"CreatedAt":"2017-03-04T05:06:07Z","Id":1,"Place":"","Likes":3,"Retweets":2}]}}`,
+			Tweet{CreatedAt: created, Id: 1, Likes: 3, Retweets: 2},
+			cacheMeta{},
+		},
+		{
+			`{"Version":5,"Users":{"a":[{"CreatedAt":"2017-03-04T05:06:07Z","Id":1,"Place":"","DeletedAt":"2018-01-02T03:04:05Z"}]}}`,
+			Tweet{CreatedAt: created, Id: 1, DeletedAt: &deleted},
+			cacheMeta{},
+		},
+		{
+			`{"Version":6,"Users":{"a":[{"CreatedAt":"2017-03-04T05:06:07Z","Id":1,"Place":""}]},"Cursors":{"a":"123"}}`,
+			Tweet{CreatedAt: created, Id: 1},
+			cacheMeta{Cursors: map[string]string{"a": "123"}},
+		},
+		{
+			`{"Version":7,"Users":{"a":[{"CreatedAt":"2017-03-04T05:06:07Z","Id":1,"Place":"","Hashtags":["go"],"Mentions":["bob"],"URLs":["https://example.com"],"Media":2}]}}`,
+			Tweet{CreatedAt: created, Id: 1, Hashtags: []string{"go"}, Mentions: []string{"bob"}, URLs: []string{"https://example.com"}, Media: 2},
+			cacheMeta{},
+		},
+		{
+			`{"Version":8,"Users":{"a":[{"CreatedAt":"2017-03-04T05:06:07Z","Id":1,"Place":""}]},"Timezones":{"a":"Europe/Paris"}}`,
+			Tweet{CreatedAt: created, Id: 1},
+			cacheMeta{Timezones: map[string]string{"a": "Europe/Paris"}},
+		},
+		{
+			`{"Version":9,"Restroom":"restroom v1.0.0","Users":{"a":[{"CreatedAt":"2017-03-04T05:06:07Z","Id":1,"Place":""}]}}`,
+			Tweet{CreatedAt: created, Id: 1},
+			cacheMeta{},
+		},
+		{
+			`{"Version":10,"Users":{"a":[{"CreatedAt":"2017-03-04T05:06:07Z","Id":1,"Place":"","Kind":"reply"}]}}`,
+			Tweet{CreatedAt: created, Id: 1, Kind: kindReply},
+			cacheMeta{},
+		},
+	}
+	if len(data) != len(jsonMigrations) {
+		t.Fatalf("%d test cases for %d migrations", len(data), len(jsonMigrations))
+	}
+	for i, l := range data {
+		p := filepath.Join(t.TempDir(), "restroom.json")
+		if err := ioutil.WriteFile(p, []byte(l.file), 0600); err != nil {
+			t.Fatal(err)
+		}
+		s, err := openJSONStore(p)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if !s.dirty {
+			t.Errorf("#%d: an upgraded cache must be saved", i)
+		}
+		if got, _ := s.LoadUser("a"); len(got) != 1 || !reflect.DeepEqual(got[0], l.tweet) {
+			t.Errorf("#%d: got %+v; want %+v", i, got, l.tweet)
+		}
+		want := newCacheMeta()
+		for k, v := range l.meta.Fetched {
+			want.Fetched[k] = v
+		}
+		for k, v := range l.meta.Aliases {
+			want.Aliases[k] = v
+		}
+		for k, v := range l.meta.Cursors {
+			want.Cursors[k] = v
+		}
+		for k, v := range l.meta.Timezones {
+			want.Timezones[k] = v
+		}
+		if got, _ := s.Meta(); !reflect.DeepEqual(got, want) {
+			t.Errorf("#%d: got %+v; want %+v", i, got, want)
+		}
+		if err := s.Flush(); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var f struct{ Version int }
+		if err := json.Unmarshal(b, &f); err != nil {
+			t.Fatal(err)
+		}
+		if f.Version != cacheVersion {
+			t.Errorf("#%d: saved version %d; want %d", i, f.Version, cacheVersion)
+		}
+	}
+}
+
+func TestMigrateJSONNewer(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "restroom.json")
+	if err := ioutil.WriteFile(p, []byte(`{"Version":1000,"Users":{}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openJSONStore(p); err == nil || !strings.Contains(err.Error(), "upgrade restroom") {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestMigrateJSONTweet(t *testing.T) {
+	// A migration renaming a field of the previous version.
+	old := jsonMigrations[cacheVersion-1]
+	defer func() { jsonMigrations[cacheVersion-1] = old }()
+	jsonMigrations[cacheVersion-1] = jsonMigration{
+		tweet: func(t map[string]json.RawMessage) error {
+			if v, ok := t["Client"]; ok {
+				t["Source"] = v
+				delete(t, "Client")
+			}
+			if _, ok := t["Bad"]; ok {
+				return errors.New("bad tweet")
+			}
+			return nil
+		},
+	}
+	d := json.NewDecoder(strings.NewReader(`[{"CreatedAt":"2017-03-04T05:06:07Z","Id":1,"Place":"","Client":"web"}]`))
+	got, err := decodeTweets(d, cacheVersion-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Tweet{{CreatedAt: time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC), Id: 1, Source: "web"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v; want %+v", got, want)
+	}
+
+	// The current version is not upgraded.
+	d = json.NewDecoder(strings.NewReader(`[{"CreatedAt":"2017-03-04T05:06:07Z","Id":1,"Place":"","Client":"web"}]`))
+	if got, err = decodeTweets(d, cacheVersion); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || len(got[0].Source) != 0 {
+		t.Fatalf("got %+v", got)
+	}
+
+	d = json.NewDecoder(strings.NewReader(`[{"CreatedAt":"2017-03-04T05:06:07Z","Id":1,"Place":"","Bad":1}]`))
+	if _, err = decodeTweets(d, 0); err == nil || !strings.Contains(err.Error(), "bad tweet") {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// https://developer.twitter.com/en/docs/authentication/oauth-2-0/authorization-code
+const (
+	twitterOAuth2AuthorizeURL = "https://twitter.com/i/oauth2/authorize"
+	twitterOAuth2TokenURL     = "https://api.twitter.com/2/oauth2/token"
+	// offline.access is needed to get a refresh token.
+	twitterOAuth2Scopes = "tweet.read users.read like.read list.read offline.access"
+)
+
+type oauth2Response struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	Scope        string `json:"scope"`
+	Error        string `json:"error"`
+	Description  string `json:"error_description"`
+}
+
+// randomString returns n random bytes encoded as URL-safe base64.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// postToken requests a token and saves it in cf.
+//
+// The refresh token is rotated on every use so the new one must be saved.
+func postToken(cf *credentialsFile, v url.Values) error {
+	v.Set("client_id", cf.ClientID)
+	resp, err := http.PostForm(twitterOAuth2TokenURL, v)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var r oauth2Response
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("%s: %s: %w", twitterOAuth2TokenURL, resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK || len(r.AccessToken) == 0 {
+		return fmt.Errorf("%s: %s: %s %s", twitterOAuth2TokenURL, resp.Status, r.Error, r.Description)
+	}
+	slog.Debug("Granted scopes", "scopes", r.Scope)
+	cf.OAuth2Scope = r.Scope
+	cf.OAuth2Token = r.AccessToken
+	cf.RefreshToken = r.RefreshToken
+	cf.OAuth2Expiry = time.Now().Add(time.Duration(r.ExpiresIn) * time.Second).UTC()
+	return nil
+}
+
+// authorizeOAuth2 runs the OAuth 2.0 authorization code flow with PKCE and
+// saves the tokens in cf. It returns the username of the user.
+//
+// redirect must be a local URL registered as callback of the app; a server
+// listens on it to receive the authorization code.
+func authorizeOAuth2(cf *credentialsFile, redirect string) (string, error) {
+	ru, err := url.Parse(redirect)
+	if err != nil {
+		return "", err
+	}
+	if ru.Scheme != "http" || (ru.Hostname() != "127.0.0.1" && ru.Hostname() != "localhost") {
+		return "", fmt.Errorf("invalid -redirect %q; expected http://127.0.0.1:<port>/<path>", redirect)
+	}
+	verifier, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	state, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(h[:])
+
+	l, err := net.Listen("tcp", ru.Host)
+	if err != nil {
+		return "", err
+	}
+	codes := make(chan string, 1)
+	errs := make(chan error, 1)
+	mux := http.NewServeMux()
+	path := ru.Path
+	if len(path) == 0 {
+		path = "/"
+	}
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("state") != state {
+			http.Error(w, "invalid state", http.StatusBadRequest)
+			return
+		}
+		if e := q.Get("error"); len(e) != 0 {
+			fmt.Fprintf(w, "Authorization failed: %s\n", e)
+			errs <- fmt.Errorf("authorization failed: %s", e)
+			return
+		}
+		fmt.Fprintf(w, "Authorized; you can close this window.\n")
+		codes <- q.Get("code")
+	})
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(l)
+	defer srv.Shutdown(context.Background())
+
+	v := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {cf.ClientID},
+		"redirect_uri":          {redirect},
+		"scope":                 {twitterOAuth2Scopes},
+		"state":                 {state},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	fmt.Printf("Open this URL in a browser and authorize the app:\n  %s?%s\n", twitterOAuth2AuthorizeURL, strings.ReplaceAll(v.Encode(), "+", "%20"))
+	var code string
+	select {
+	case code = <-codes:
+	case err := <-errs:
+		return "", err
+	case <-time.After(10 * time.Minute):
+		return "", errors.New("timed out waiting for the authorization")
+	}
+	err = postToken(cf, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirect},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		return "", err
+	}
+	var u v2User
+	if err := getJSON(context.Background(), twitterV2URL+"/users/me", cf.OAuth2Token, &u); err != nil {
+		return "", err
+	}
+	return u.Data.Username, nil
+}
+
+// oauth2Mu serializes the use of the OAuth 2.0 tokens. The refresh token is
+// single use, so the workers of -workers must not refresh it concurrently.
+var oauth2Mu sync.Mutex
+
+// oauth2Tokens are the access tokens of the profiles as last loaded or
+// refreshed.
+var oauth2Tokens = map[string]*oauth2Cached{}
+
+type oauth2Cached struct {
+	token  string
+	scope  string
+	expiry time.Time
+}
+
+// valid returns true if c can be used and is not the rejected token stale.
+func (c *oauth2Cached) valid(stale string) bool {
+	return len(c.token) != 0 && c.token != stale && time.Now().Before(c.expiry.Add(-time.Minute))
+}
+
+// oauth2Token returns the OAuth 2.0 access token of profile, refreshing it if
+// it expired. It returns errNoCredentials if there is none.
+func oauth2Token(profile string) (string, error) {
+	tok, _, err := oauth2TokenScope(profile, "")
+	return tok, err
+}
+
+// oauth2TokenScope is like oauth2Token but also returns the granted scopes.
+// stale is the token that was rejected, if any, so it is refreshed even if it
+// didn't expire yet.
+func oauth2TokenScope(profile, stale string) (string, string, error) {
+	oauth2Mu.Lock()
+	defer oauth2Mu.Unlock()
+	if c := oauth2Tokens[profile]; c != nil && c.valid(stale) {
+		return c.token, c.scope, nil
+	}
+	// Reload the file in case another restroom refreshed the token.
+	all, err := loadCredentialsFile()
+	if err != nil {
+		return "", "", err
+	}
+	cf, err := all.profile(profile)
+	if err != nil {
+		return "", "", err
+	}
+	if len(cf.OAuth2Token) == 0 {
+		return "", "", errNoCredentials
+	}
+	c := &oauth2Cached{token: cf.OAuth2Token, scope: cf.OAuth2Scope, expiry: cf.OAuth2Expiry}
+	if !c.valid(stale) {
+		if len(cf.RefreshToken) == 0 {
+			return "", "", errors.New("the OAuth 2.0 token expired; run restroom auth -oauth2 again")
+		}
+		slog.Info("Refreshing the OAuth 2.0 token")
+		sec := all.section(profile)
+		if err := sec.unlock(profile); err != nil {
+			return "", "", err
+		}
+		err = postToken(sec, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {sec.RefreshToken},
+		})
+		if err != nil {
+			return "", "", err
+		}
+		c = &oauth2Cached{token: sec.OAuth2Token, scope: sec.OAuth2Scope, expiry: sec.OAuth2Expiry}
+		if _, err := all.store(sec, profile, sec.Keyring); err != nil {
+			return "", "", err
+		}
+	}
+	oauth2Tokens[profile] = c
+	return c.token, c.scope, nil
+}
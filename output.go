@@ -0,0 +1,791 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// outputs are the formats supported by -o. Each prints the sections of the
+// report to w.
+var outputs = map[string]func(w io.Writer, l []*stats) error{
+	"csv":       printCSV,
+	"json":      printJSON,
+	"markdown":  printMarkdown,
+	"sparkline": printSparkline,
+	"text":      printText,
+}
+
+// fileOutputs are the formats supported by -o that write files in the -out
+// directory. Each returns the paths of the files written.
+var fileOutputs = map[string]func(dir string, l []*stats) ([]string, error){}
+
+func outputNames() []string {
+	out := make([]string, 0, len(outputs)+len(fileOutputs))
+	for n := range outputs {
+		out = append(out, n)
+	}
+	for n := range fileOutputs {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// placesByName is set with -places-sort name to list the places
+// alphabetically instead of the most frequent first.
+var placesByName bool
+
+// places returns the places of s in the order selected with -places-sort.
+func (s *stats) places() []string {
+	if placesByName {
+		out := make([]string, 0, len(s.Places))
+		for p := range s.Places {
+			out = append(out, p)
+		}
+		sort.Strings(out)
+		return out
+	}
+	return s.placesByCount()
+}
+
+// placesByCount returns the places of s, the most frequent first.
+func (s *stats) placesByCount() []string {
+	return byCount(s.Places)
+}
+
+// kinds returns the kinds of the tweets of s.
+func (s *stats) kinds() []string {
+	var out []string
+	for _, k := range kinds {
+		if s.Kinds[k] != 0 {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// kindShares returns the share of the tweets of kind k per hour, in per mille.
+func (s *stats) kindShares(k string) []int {
+	out := make([]int, 24)
+	for h, n := range s.KindHours[k] {
+		if s.Hours[h] != 0 {
+			out[h] = 1000 * n / s.Hours[h]
+		}
+	}
+	return out
+}
+
+// clients returns the clients of s, the most used first.
+func (s *stats) clients() []string {
+	return byCount(s.Clients)
+}
+
+// byCount returns the keys of m, the highest count first.
+func byCount(m map[string]int) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if a, b := m[out[i]], m[out[j]]; a != b {
+			return a > b
+		}
+		return out[i] < out[j]
+	})
+	return out
+}
+
+// titles returns the titles of the hour and weekday histograms.
+func (s *stats) titles() (string, string) {
+	if s.Mentions {
+		return "Mentions received by hour", "Mentions received by weekday"
+	}
+	return "Favorite hour", "Favorite weekday"
+}
+
+// punchcardTitle returns the title of the weekday and hour matrix.
+func (s *stats) punchcardTitle() string {
+	if s.Mentions {
+		return "Mentions received by weekday and hour"
+	}
+	return "Tweets by weekday and hour"
+}
+
+// trendTitle returns the title of the tweets per period, e.g. "month".
+func (s *stats) trendTitle(period string) string {
+	if s.Mentions {
+		return "Mentions received per " + period
+	}
+	return "Tweets per " + period
+}
+
+// months returns every month from the first tweet to the last one as
+// YYYY-MM, including the months without tweets.
+func (s *stats) months() []string {
+	if s.From == nil {
+		return nil
+	}
+	var out []string
+	first := time.Date(s.From.Year(), s.From.Month(), 1, 0, 0, 0, 0, time.UTC)
+	last := s.To.Format("2006-01")
+	for m := first; ; m = m.AddDate(0, 1, 0) {
+		out = append(out, m.Format("2006-01"))
+		if out[len(out)-1] >= last {
+			return out
+		}
+	}
+}
+
+// years returns every year from the first tweet to the last one, including
+// the years without tweets.
+func (s *stats) years() []string {
+	if s.From == nil {
+		return nil
+	}
+	var out []string
+	for y := s.From.Year(); y <= s.To.Year(); y++ {
+		out = append(out, strconv.Itoa(y))
+	}
+	return out
+}
+
+// slot is an hour of a weekday of the punchcard.
+type slot struct {
+	Weekday time.Weekday
+	Hour    int
+	Tweets  int
+}
+
+func (t slot) String() string {
+	return cal.days[t.Weekday] + " " + clockLabel(t.Hour)
+}
+
+// peaks returns up to n hours of the week with the most tweets, the busiest
+// first.
+func (s *stats) peaks(n int) []slot {
+	var out []slot
+	for _, d := range cal.order() {
+		for h, c := range s.Punchcard[d] {
+			if c != 0 {
+				out = append(out, slot{Weekday: d, Hour: h, Tweets: c})
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Tweets > out[j].Tweets })
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// printText prints the histograms as bars scaled to the width of the terminal.
+func printText(w io.Writer, l []*stats) error {
+	writeText(w, l, termWidth(w), useColor(w))
+	return nil
+}
+
+// writeText prints the histograms as bars fitting in cols columns. With color,
+// the peaks are highlighted and the empty buckets dimmed.
+func writeText(w io.Writer, l []*stats, cols int, color bool) {
+	for i, s := range l {
+		if i != 0 {
+			fmt.Fprintln(w)
+		}
+		if len(s.Name) != 0 {
+			fmt.Fprintln(w, paint("== "+s.Name+" ==", "1", color))
+		}
+		fmt.Fprintf(w, "Processed %d tweets\n", s.Tweets)
+		if s.Cadence != nil {
+			fmt.Fprintf(w, "Cadence: %s\n", s.Cadence)
+		}
+		if len(s.Gaps) != 0 {
+			fmt.Fprintf(w, "Largest gaps:\n")
+			for _, g := range s.Gaps {
+				l := "  " + g.String()
+				if g.Wall {
+					l = paint(l, colorWarn, color)
+				}
+				fmt.Fprintln(w, l)
+			}
+		}
+		hourTitle, weekdayTitle := s.titles()
+		fmt.Fprintf(w, "%s in %s:\n", hourTitle, s.Timezone)
+		max := maxOf(s.Hours[:])
+		hourLen := len(hourLabel(23))
+		for i, n := range s.Hours {
+			fmt.Fprintln(w, barLine(fmt.Sprintf("  %*s: %3d ", hourLen, hourLabel(i), n), n, max, cols, color))
+		}
+		if s.Chronotype != nil {
+			fmt.Fprintf(w, "Chronotype: %s\n", s.Chronotype)
+		}
+		fmt.Fprintf(w, "%s in %s:\n", weekdayTitle, s.Timezone)
+		max = maxOf(s.Weekdays[:])
+		daysLen := maxLen(cal.days[:])
+		for _, d := range cal.order() {
+			n := s.Weekdays[d]
+			fmt.Fprintln(w, barLine(fmt.Sprintf("  %s: %3d ", padLeft(cal.days[d], daysLen), n), n, max, cols, color))
+		}
+		fmt.Fprintf(w, "%s in %s:\n", s.punchcardTitle(), s.Timezone)
+		printPunchcard(w, s)
+		if p := s.peaks(3); len(p) != 0 {
+			l := make([]string, len(p))
+			for i, t := range p {
+				l[i] = fmt.Sprintf("%s (%d)", t, t.Tweets)
+			}
+			fmt.Fprintf(w, "Busiest: %s\n", strings.Join(l, ", "))
+		}
+		printTrend(w, s, cols, color)
+		printKinds(w, s, cols, color)
+		printClients(w, s, cols, color)
+		printLengths(w, s)
+		printHashtags(w, s, cols, color)
+		printPartners(w, s, cols, color)
+		fmt.Fprintf(w, "Favorite places:\n")
+		places := s.places()
+		max = 1
+		placesLen := 0
+		for _, p := range places {
+			if max < s.Places[p] {
+				max = s.Places[p]
+			}
+			if l := utf8.RuneCountInString(p); l > placesLen {
+				placesLen = l
+			}
+		}
+		for _, p := range places {
+			fmt.Fprintln(w, barLine(fmt.Sprintf("  %*s: %d ", placesLen, p, s.Places[p]), s.Places[p], max, cols, color))
+		}
+	}
+}
+
+// printTrend prints the tweets per year as bars, and per month as a line of
+// twelve blocks per year.
+func printTrend(w io.Writer, s *stats, cols int, color bool) {
+	years := s.years()
+	if len(years) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s:\n", s.trendTitle("year"))
+	max := 0
+	for _, y := range years {
+		if max < s.Years[y] {
+			max = s.Years[y]
+		}
+	}
+	for _, y := range years {
+		fmt.Fprintln(w, barLine(fmt.Sprintf("  %s: %5d ", y, s.Years[y]), s.Years[y], max, cols, color))
+	}
+	// Scale the months of all the years together.
+	var months []int
+	for _, y := range years {
+		for m := 1; m <= 12; m++ {
+			months = append(months, s.Months[fmt.Sprintf("%s-%02d", y, m)])
+		}
+	}
+	line := []rune(sparkline(months))
+	fmt.Fprintf(w, "%s, January to December:\n", s.trendTitle("month"))
+	for i, y := range years {
+		fmt.Fprintf(w, "  %s: %s\n", y, string(line[12*i:12*i+12]))
+	}
+}
+
+// printKinds prints the share of each kind of tweets and, for each, its share
+// of the tweets per hour as a sparkline.
+func printKinds(w io.Writer, s *stats, cols int, color bool) {
+	l := s.kinds()
+	if len(l) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Composition:\n")
+	width := maxLen(l)
+	max := 0
+	for _, k := range l {
+		if max < s.Kinds[k] {
+			max = s.Kinds[k]
+		}
+	}
+	for _, k := range l {
+		fmt.Fprintln(w, barLine(fmt.Sprintf("  %s: %d, %s%% ", padLeft(k, width), s.Kinds[k], percent(s.Kinds[k], s.Tweets)), s.Kinds[k], max, cols, color))
+	}
+	fmt.Fprintf(w, "Share of the tweets per hour, from %s to %s:\n", hourLabel(0), hourLabel(23))
+	for _, k := range l {
+		fmt.Fprintf(w, "  %s: %s\n", padLeft(k, width), sparkline(s.kindShares(k)))
+	}
+}
+
+// printLengths prints the length of the original tweets and of the replies,
+// with the histograms as sparklines.
+func printLengths(w io.Writer, s *stats) {
+	for _, k := range s.lengthKinds() {
+		l := s.Lengths[k]
+		fmt.Fprintf(w, "Length of the %d %s tweets: %s\n", l.Tweets, k, l)
+		fmt.Fprintf(w, "  characters, by %d up to %d: %s\n", charsBucket, charsMax, sparkline(l.Chars))
+		fmt.Fprintf(w, "  words, by %d up to %d:       %s\n", wordsBucket, wordsMax, sparkline(l.Words))
+	}
+}
+
+// printClients prints the tweets per client and, for each, the tweets per
+// hour as a sparkline.
+func printClients(w io.Writer, s *stats, cols int, color bool) {
+	clients := s.clients()
+	if len(clients) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Clients:\n")
+	width := maxLen(clients)
+	max := s.Clients[clients[0]]
+	for _, c := range clients {
+		fmt.Fprintln(w, barLine(fmt.Sprintf("  %s: %d ", padLeft(c, width), s.Clients[c]), s.Clients[c], max, cols, color))
+	}
+	fmt.Fprintf(w, "Clients by hour, from %s to %s:\n", hourLabel(0), hourLabel(23))
+	for _, c := range clients {
+		h := s.ClientHours[c]
+		fmt.Fprintf(w, "  %s: %s\n", padLeft(c, width), sparkline(h[:]))
+	}
+}
+
+// printHashtags prints the most used hashtags with when they were first and
+// last used, then the most used each month.
+func printHashtags(w io.Writer, s *stats, cols int, color bool) {
+	if len(s.Hashtags) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Hashtags:\n")
+	l := make([]string, len(s.Hashtags))
+	for i, h := range s.Hashtags {
+		l[i] = "#" + h.Tag
+	}
+	width := maxLen(l)
+	max := s.Hashtags[0].Tweets
+	for i, h := range s.Hashtags {
+		line := fmt.Sprintf("  %s: %d, %s to %s ", padLeft(l[i], width), h.Tweets, h.First.Format("2006-01-02"), h.Last.Format("2006-01-02"))
+		fmt.Fprintln(w, barLine(line, h.Tweets, max, cols, color))
+	}
+	fmt.Fprintf(w, "Hashtags per month:\n")
+	for _, m := range s.hashtagMonths() {
+		fmt.Fprintf(w, "  %s: %s\n", m, formatTagCounts(s.MonthHashtags[m]))
+	}
+}
+
+// printPartners prints the accounts the most mentioned or replied to, with
+// the share of the tweets mentioning them.
+func printPartners(w io.Writer, s *stats, cols int, color bool) {
+	if len(s.Partners) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Interactions:\n")
+	l := make([]string, len(s.Partners))
+	for i, p := range s.Partners {
+		l[i] = "@" + p.User
+	}
+	width := maxLen(l)
+	max := s.Partners[0].Tweets
+	for i, p := range s.Partners {
+		line := fmt.Sprintf("  %s: %d, %s%% ", padLeft(l[i], width), p.Tweets, percent(p.Tweets, s.Tweets))
+		fmt.Fprintln(w, barLine(line, p.Tweets, max, cols, color))
+	}
+}
+
+// formatTagCounts returns the hashtags and their count, e.g. "#go 3, #a 1".
+func formatTagCounts(l []tagCount) string {
+	out := make([]string, len(l))
+	for i, t := range l {
+		out[i] = fmt.Sprintf("#%s %d", t.Tag, t.Tweets)
+	}
+	return strings.Join(out, ", ")
+}
+
+// barLine returns line followed by the bar of n/max filling cols columns.
+func barLine(line string, n, max, cols int, color bool) string {
+	b := bar(n, max, cols-utf8.RuneCountInString(line))
+	switch {
+	case n == 0:
+		return paint(line, colorDim, color)
+	case n == max:
+		return line + paint(b, colorPeak, color)
+	}
+	return line + b
+}
+
+// printPunchcard prints the tweets per weekday and hour as a grid of shaded
+// blocks, two columns per hour.
+func printPunchcard(w io.Writer, s *stats) {
+	max := 1
+	for _, r := range s.Punchcard {
+		if m := maxOf(r[:]); m > max {
+			max = m
+		}
+	}
+	abbrLen := maxLen(cal.abbr[:])
+	fmt.Fprintf(w, "    %s", strings.Repeat(" ", abbrLen))
+	for h := 0; h < 24; h += 3 {
+		fmt.Fprintf(w, "%-6s", hourLabel(h))
+	}
+	fmt.Fprintln(w)
+	shades := []string{"░░", "▒▒", "▓▓", "██"}
+	for _, d := range cal.order() {
+		fmt.Fprintf(w, "  %s  ", padLeft(cal.abbr[d], abbrLen))
+		for _, n := range s.Punchcard[d] {
+			if n == 0 {
+				fmt.Fprintf(w, "· ")
+			} else {
+				fmt.Fprintf(w, "%s", shades[(len(shades)*n-1)/max])
+			}
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// termWidth returns the number of columns of the terminal w is, or of $COLUMNS
+// otherwise.
+func termWidth(w io.Writer) int {
+	if f, ok := w.(*os.File); ok {
+		if c, _, err := term.GetSize(int(f.Fd())); err == nil && c > 0 {
+			return c
+		}
+	}
+	if c, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && c > 0 {
+		return c
+	}
+	return 80
+}
+
+// maxOf returns the largest value of l, at least 1.
+func maxOf(l []int) int {
+	max := 1
+	for _, n := range l {
+		if max < n {
+			max = n
+		}
+	}
+	return max
+}
+
+// bar returns n/max as a bar of block characters at most width columns long,
+// with a precision of an eighth of a column.
+func bar(n, max, width int) string {
+	if width < 10 {
+		width = 10
+	}
+	// Keep the last column free so the line doesn't wrap.
+	eighths := (8*(width-1)*n + max/2) / max
+	b := strings.Repeat("█", eighths/8)
+	if r := eighths % 8; r != 0 {
+		// U+2589 to U+258F are the left seven eighths to the left one eighth
+		// block.
+		b += string(rune('█' + 8 - r))
+	}
+	return b
+}
+
+// printSparkline prints a line per section with the hours histogram as a
+// sparkline, to compare many users at a glance.
+func printSparkline(w io.Writer, l []*stats) error {
+	nameLen := 0
+	for _, s := range l {
+		if n := utf8.RuneCountInString(s.Name); n > nameLen {
+			nameLen = n
+		}
+	}
+	for _, s := range l {
+		if nameLen != 0 {
+			fmt.Fprintf(w, "%-*s ", nameLen, s.Name)
+		}
+		fmt.Fprintf(w, "%s %d\n", sparkline(s.Hours[:]), s.Tweets)
+	}
+	return nil
+}
+
+// sparkline returns l as a string of eighth blocks, with a space for zero so
+// the quiet hours stand out.
+func sparkline(l []int) string {
+	max := maxOf(l)
+	var b strings.Builder
+	for _, n := range l {
+		if n == 0 {
+			b.WriteRune(' ')
+		} else {
+			// U+2581 to U+2588 are the lower one eighth to the full block.
+			b.WriteRune(rune('▁' + (8*n-1)/max))
+		}
+	}
+	return b.String()
+}
+
+// printJSON prints the stats as a JSON object, or an array of objects when
+// there are several sections.
+func printJSON(w io.Writer, l []*stats) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	if len(l) == 1 {
+		return e.Encode(l[0])
+	}
+	return e.Encode(l)
+}
+
+// printCSV prints one row per bucket of the histograms, which is easy to pivot
+// in a spreadsheet.
+func printCSV(w io.Writer, l []*stats) error {
+	c := csv.NewWriter(w)
+	c.Write([]string{"user", "histogram", "bucket", "tweets"})
+	for _, s := range l {
+		for i, n := range s.Hours {
+			c.Write([]string{s.Name, "hour", strconv.Itoa(i), strconv.Itoa(n)})
+		}
+		for i, n := range s.Weekdays {
+			c.Write([]string{s.Name, "weekday", time.Weekday(i).String(), strconv.Itoa(n)})
+		}
+		for d, r := range s.Punchcard {
+			for h, n := range r {
+				c.Write([]string{s.Name, "weekday-hour", fmt.Sprintf("%s %02d", time.Weekday(d), h), strconv.Itoa(n)})
+			}
+		}
+		for _, m := range s.months() {
+			c.Write([]string{s.Name, "month", m, strconv.Itoa(s.Months[m])})
+		}
+		for _, y := range s.years() {
+			c.Write([]string{s.Name, "year", y, strconv.Itoa(s.Years[y])})
+		}
+		for _, p := range s.places() {
+			c.Write([]string{s.Name, "place", p, strconv.Itoa(s.Places[p])})
+		}
+		if d := s.Cadence; d != nil {
+			c.Write([]string{s.Name, "cadence", "longest streak", strconv.Itoa(d.LongestStreak)})
+			c.Write([]string{s.Name, "cadence", "longest drought", strconv.Itoa(d.LongestDrought)})
+			c.Write([]string{s.Name, "cadence", "per day", strconv.FormatFloat(d.PerDay, 'g', 4, 64)})
+			c.Write([]string{s.Name, "cadence", "median interval", strconv.FormatFloat(d.MedianInterval, 'f', 0, 64)})
+		}
+		for _, k := range s.kinds() {
+			c.Write([]string{s.Name, "kind", k, strconv.Itoa(s.Kinds[k])})
+		}
+		for _, k := range s.kinds() {
+			for h, n := range s.KindHours[k] {
+				c.Write([]string{s.Name, "kind-hour", fmt.Sprintf("%s %02d", k, h), strconv.Itoa(n)})
+			}
+		}
+		for _, k := range s.lengthKinds() {
+			l := s.Lengths[k]
+			for i, n := range l.Chars {
+				c.Write([]string{s.Name, "length-chars", k + " " + bucketLabel(i, charsBucket, charsMax), strconv.Itoa(n)})
+			}
+			for i, n := range l.Words {
+				c.Write([]string{s.Name, "length-words", k + " " + bucketLabel(i, wordsBucket, wordsMax), strconv.Itoa(n)})
+			}
+			c.Write([]string{s.Name, "length-limit", k, strconv.Itoa(l.AtLimit)})
+		}
+		for _, cl := range s.clients() {
+			c.Write([]string{s.Name, "client", cl, strconv.Itoa(s.Clients[cl])})
+		}
+		for _, cl := range s.clients() {
+			for h, n := range s.ClientHours[cl] {
+				c.Write([]string{s.Name, "client-hour", fmt.Sprintf("%s %02d", cl, h), strconv.Itoa(n)})
+			}
+		}
+		for _, h := range s.Hashtags {
+			c.Write([]string{s.Name, "hashtag", h.Tag, strconv.Itoa(h.Tweets)})
+		}
+		for _, m := range s.hashtagMonths() {
+			for _, t := range s.MonthHashtags[m] {
+				c.Write([]string{s.Name, "month-hashtag", m + " " + t.Tag, strconv.Itoa(t.Tweets)})
+			}
+		}
+		for _, p := range s.Partners {
+			c.Write([]string{s.Name, "partner", p.User, strconv.Itoa(p.Tweets)})
+		}
+		if t := s.Chronotype; t != nil {
+			c.Write([]string{s.Name, "chronotype", t.Label, strconv.FormatFloat(t.Confidence, 'f', 2, 64)})
+			c.Write([]string{s.Name, "sleep", fmt.Sprintf("%02d-%02d", t.SleepFrom, t.sleepTo()), strconv.Itoa(t.SleepHours)})
+		}
+		for _, g := range s.Gaps {
+			c.Write([]string{s.Name, "gap", g.From.Format(time.RFC3339) + "/" + g.To.Format(time.RFC3339), strconv.FormatFloat(g.duration().Seconds(), 'f', 0, 64)})
+		}
+	}
+	c.Flush()
+	return c.Error()
+}
+
+// printMarkdown prints the histograms as Markdown tables, e.g. to paste in a
+// GitHub issue.
+func printMarkdown(w io.Writer, l []*stats) error {
+	for i, s := range l {
+		if i != 0 {
+			fmt.Fprintln(w)
+		}
+		if len(s.Name) != 0 {
+			fmt.Fprintf(w, "## %s\n\n", s.Name)
+		}
+		if s.Tweets == 0 {
+			fmt.Fprintf(w, "No tweets.\n")
+			continue
+		}
+		fmt.Fprintf(w, "%d tweets from %s to %s, in %s.\n", s.Tweets, s.From.Format("2006-01-02"), s.To.Format("2006-01-02"), s.Timezone)
+		if d := s.Cadence; d != nil {
+			fmt.Fprintf(w, "\n### Cadence\n\n| | |\n|:---|---:|\n")
+			fmt.Fprintf(w, "| Longest streak | %s from %s |\n", days(d.LongestStreak), d.StreakFrom)
+			if d.LongestDrought != 0 {
+				fmt.Fprintf(w, "| Longest drought | %s from %s |\n", days(d.LongestDrought), d.DroughtFrom)
+			}
+			fmt.Fprintf(w, "| Tweets per day | %s |\n", formatRate(d.PerDay))
+			if d.MedianInterval != 0 {
+				fmt.Fprintf(w, "| Median interval | %s |\n", formatInterval(d.medianInterval()))
+			}
+		}
+		if len(s.Gaps) != 0 {
+			fmt.Fprintf(w, "\n### Largest gaps\n\n")
+			for _, g := range s.Gaps {
+				fmt.Fprintf(w, "- %s\n", g)
+			}
+		}
+		hourTitle, weekdayTitle := s.titles()
+		fmt.Fprintf(w, "\n### %s\n\n| Hour | Tweets | %% |\n|---:|---:|---:|\n", hourTitle)
+		for h, n := range s.Hours {
+			fmt.Fprintf(w, "| %s | %d | %s |\n", hourLabel(h), n, percent(n, s.Tweets))
+		}
+		if s.Chronotype != nil {
+			fmt.Fprintf(w, "\nChronotype: %s.\n", s.Chronotype)
+		}
+		fmt.Fprintf(w, "\n### %s\n\n| Weekday | Tweets | %% |\n|:---|---:|---:|\n", weekdayTitle)
+		for _, d := range cal.order() {
+			n := s.Weekdays[d]
+			fmt.Fprintf(w, "| %s | %d | %s |\n", cal.days[d], n, percent(n, s.Tweets))
+		}
+		fmt.Fprintf(w, "\n### %s\n\n| |", s.punchcardTitle())
+		for h := 0; h < 24; h++ {
+			fmt.Fprintf(w, " %s |", hourTick(h))
+		}
+		fmt.Fprintf(w, "\n|:---|%s\n", strings.Repeat("---:|", 24))
+		for _, d := range cal.order() {
+			fmt.Fprintf(w, "| %s |", cal.abbr[d])
+			for _, n := range s.Punchcard[d] {
+				fmt.Fprintf(w, " %d |", n)
+			}
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "\n### %s\n\n| Year |", s.trendTitle("month"))
+		for m := time.January; m <= time.December; m++ {
+			fmt.Fprintf(w, " %02d |", int(m))
+		}
+		fmt.Fprintf(w, " Total |\n|:---|%s---:|\n", strings.Repeat("---:|", 12))
+		for _, y := range s.years() {
+			fmt.Fprintf(w, "| %s |", y)
+			for m := 1; m <= 12; m++ {
+				fmt.Fprintf(w, " %d |", s.Months[fmt.Sprintf("%s-%02d", y, m)])
+			}
+			fmt.Fprintf(w, " %d |\n", s.Years[y])
+		}
+		if l := s.kinds(); len(l) != 0 {
+			fmt.Fprintf(w, "\n### Composition\n\n| Kind | Tweets | %% |\n|:---|---:|---:|\n")
+			for _, k := range l {
+				fmt.Fprintf(w, "| %s | %d | %s |\n", k, s.Kinds[k], percent(s.Kinds[k], s.Tweets))
+			}
+			fmt.Fprintf(w, "\n### Share of the tweets per hour, in %%\n\n| |")
+			for h := 0; h < 24; h++ {
+				fmt.Fprintf(w, " %s |", hourTick(h))
+			}
+			fmt.Fprintf(w, "\n|:---|%s\n", strings.Repeat("---:|", 24))
+			for _, k := range l {
+				fmt.Fprintf(w, "| %s |", k)
+				for _, n := range s.kindShares(k) {
+					fmt.Fprintf(w, " %d |", (n+5)/10)
+				}
+				fmt.Fprintln(w)
+			}
+		}
+		if l := s.lengthKinds(); len(l) != 0 {
+			fmt.Fprintf(w, "\n### Length\n\n| Kind | Tweets | Median characters | Mean characters | Median words | Mean words | At the limit %% |\n|:---|---:|---:|---:|---:|---:|---:|\n")
+			for _, k := range l {
+				d := s.Lengths[k]
+				fmt.Fprintf(w, "| %s | %d | %s | %.1f | %s | %.1f | %s |\n", k, d.Tweets, formatMedian(d.MedianChars), d.MeanChars, formatMedian(d.MedianWords), d.MeanWords, percent(d.AtLimit, d.Tweets))
+			}
+			fmt.Fprintf(w, "\n| Characters |")
+			for _, k := range l {
+				fmt.Fprintf(w, " %s |", k)
+			}
+			fmt.Fprintf(w, "\n|:---|%s\n", strings.Repeat("---:|", len(l)))
+			for i := 0; i <= charsMax/charsBucket; i++ {
+				fmt.Fprintf(w, "| %s |", bucketLabel(i, charsBucket, charsMax))
+				for _, k := range l {
+					fmt.Fprintf(w, " %d |", s.Lengths[k].Chars[i])
+				}
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "\n| Words |")
+			for _, k := range l {
+				fmt.Fprintf(w, " %s |", k)
+			}
+			fmt.Fprintf(w, "\n|:---|%s\n", strings.Repeat("---:|", len(l)))
+			for i := 0; i <= wordsMax/wordsBucket; i++ {
+				fmt.Fprintf(w, "| %s |", bucketLabel(i, wordsBucket, wordsMax))
+				for _, k := range l {
+					fmt.Fprintf(w, " %d |", s.Lengths[k].Words[i])
+				}
+				fmt.Fprintln(w)
+			}
+		}
+		if clients := s.clients(); len(clients) != 0 {
+			fmt.Fprintf(w, "\n### Clients\n\n| Client | Tweets | %% |\n|:---|---:|---:|\n")
+			for _, c := range clients {
+				fmt.Fprintf(w, "| %s | %d | %s |\n", escapeMarkdown(c), s.Clients[c], percent(s.Clients[c], s.Tweets))
+			}
+			fmt.Fprintf(w, "\n### Clients by hour\n\n| |")
+			for h := 0; h < 24; h++ {
+				fmt.Fprintf(w, " %s |", hourTick(h))
+			}
+			fmt.Fprintf(w, "\n|:---|%s\n", strings.Repeat("---:|", 24))
+			for _, c := range clients {
+				fmt.Fprintf(w, "| %s |", escapeMarkdown(c))
+				for _, n := range s.ClientHours[c] {
+					fmt.Fprintf(w, " %d |", n)
+				}
+				fmt.Fprintln(w)
+			}
+		}
+		if len(s.Hashtags) != 0 {
+			fmt.Fprintf(w, "\n### Hashtags\n\n| Hashtag | Tweets | First | Last |\n|:---|---:|---:|---:|\n")
+			for _, h := range s.Hashtags {
+				fmt.Fprintf(w, "| #%s | %d | %s | %s |\n", escapeMarkdown(h.Tag), h.Tweets, h.First.Format("2006-01-02"), h.Last.Format("2006-01-02"))
+			}
+			fmt.Fprintf(w, "\n### Hashtags per month\n\n| Month | Hashtags |\n|:---|:---|\n")
+			for _, m := range s.hashtagMonths() {
+				fmt.Fprintf(w, "| %s | %s |\n", m, escapeMarkdown(formatTagCounts(s.MonthHashtags[m])))
+			}
+		}
+		if len(s.Partners) != 0 {
+			fmt.Fprintf(w, "\n### Interactions\n\n| Account | Tweets | %% |\n|:---|---:|---:|\n")
+			for _, p := range s.Partners {
+				fmt.Fprintf(w, "| @%s | %d | %s |\n", escapeMarkdown(p.User), p.Tweets, percent(p.Tweets, s.Tweets))
+			}
+		}
+		if len(s.Places) != 0 {
+			fmt.Fprintf(w, "\n### Favorite places\n\n| Place | Tweets | %% |\n|:---|---:|---:|\n")
+			for _, p := range s.places() {
+				fmt.Fprintf(w, "| %s | %d | %s |\n", escapeMarkdown(p), s.Places[p], percent(s.Places[p], s.Tweets))
+			}
+		}
+	}
+	return nil
+}
+
+// percent returns n/total as a percentage.
+func percent(n, total int) string {
+	return strconv.FormatFloat(100*float64(n)/float64(total), 'f', 1, 64)
+}
+
+// escapeMarkdown escapes the characters that would break a table cell.
+func escapeMarkdown(s string) string {
+	return strings.NewReplacer("|", "\\|", "*", "\\*", "_", "\\_", "`", "\\`").Replace(s)
+}
@@ -0,0 +1,55 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import "strings"
+
+// partner is an account the user interacts with.
+type partner struct {
+	// User is the screen name, as spelled the first time it was mentioned.
+	User string
+	// Tweets is the number of tweets mentioning or replying to the account.
+	Tweets int
+}
+
+// partnerCounter counts the accounts mentioned by tweets. The screen names
+// are compared case insensitively.
+type partnerCounter struct {
+	counts map[string]int
+	names  map[string]string
+}
+
+func newPartnerCounter() *partnerCounter {
+	return &partnerCounter{counts: map[string]int{}, names: map[string]string{}}
+}
+
+// add counts the accounts mentioned by t. The replies mention the account
+// replied to, so they are counted too.
+func (p *partnerCounter) add(t *Tweet) {
+	seen := map[string]bool{}
+	for _, u := range t.Mentions {
+		k := strings.ToLower(strings.TrimPrefix(u, "@"))
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		if _, ok := p.names[k]; !ok {
+			p.names[k] = strings.TrimPrefix(u, "@")
+		}
+		p.counts[k]++
+	}
+}
+
+// top returns the n accounts the most mentioned.
+func (p *partnerCounter) top(n int) []partner {
+	var out []partner
+	for _, k := range byCount(p.counts) {
+		if len(out) == n {
+			break
+		}
+		out = append(out, partner{User: p.names[k], Tweets: p.counts[k]})
+	}
+	return out
+}
@@ -0,0 +1,108 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"time"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+)
+
+func init() {
+	fileOutputs["png"] = writePNG
+}
+
+// barColor is the same as in the SVG and HTML charts.
+var barColor = color.RGBA{0x4a, 0x7e, 0xbb, 0xff}
+
+// writePNG writes the histograms and the tweets per month of each section as
+// PNG files.
+func writePNG(dir string, l []*stats) ([]string, error) {
+	var out []string
+	for _, s := range l {
+		for _, c := range s.charts() {
+			p, err := c.plot()
+			if err != nil {
+				return out, err
+			}
+			path := chartPath(dir, s, c, ".png")
+			if err := savePlot(p, path); err != nil {
+				return out, err
+			}
+			out = append(out, path)
+		}
+		if s.Tweets == 0 {
+			continue
+		}
+		p, err := s.timeline()
+		if err != nil {
+			return out, err
+		}
+		path := chartPath(dir, s, chart{name: "months"}, ".png")
+		if err := savePlot(p, path); err != nil {
+			return out, err
+		}
+		out = append(out, path)
+	}
+	return out, nil
+}
+
+// savePlot renders p as a PNG file.
+func savePlot(p *plot.Plot, path string) error {
+	w, err := p.WriterTo(8*vg.Inch, 4*vg.Inch, "png")
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if _, err := w.WriteTo(&b); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b.Bytes(), 0644, false)
+}
+
+// plot returns c as a bar chart.
+func (c *chart) plot() (*plot.Plot, error) {
+	p := plot.New()
+	p.Title.Text = c.title
+	p.Y.Label.Text = "Tweets"
+	v := make(plotter.Values, len(c.values))
+	for i, n := range c.values {
+		v[i] = float64(n)
+	}
+	b, err := plotter.NewBarChart(v, vg.Points(16))
+	if err != nil {
+		return nil, err
+	}
+	b.LineStyle.Width = 0
+	b.Color = barColor
+	p.Add(b)
+	p.NominalX(c.labels...)
+	return p, nil
+}
+
+// timeline returns the number of tweets per month of s as a line, including
+// the months without any.
+func (s *stats) timeline() (*plot.Plot, error) {
+	p := plot.New()
+	p.Title.Text = "Tweets per month"
+	p.Y.Label.Text = "Tweets"
+	p.X.Tick.Marker = plot.TimeTicks{Format: "2006-01"}
+	first := time.Date(s.From.Year(), s.From.Month(), 1, 0, 0, 0, 0, s.From.Location())
+	var xy plotter.XYs
+	for m := first; !m.After(*s.To); m = m.AddDate(0, 1, 0) {
+		xy = append(xy, plotter.XY{X: float64(m.Unix()), Y: float64(s.Months[m.Format("2006-01")])})
+	}
+	l, err := plotter.NewLine(xy)
+	if err != nil {
+		return nil, err
+	}
+	l.Color = barColor
+	p.Add(l)
+	return p, nil
+}
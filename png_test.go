@@ -0,0 +1,52 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWritePNG(t *testing.T) {
+	from := time.Date(2020, 1, 2, 3, 0, 0, 0, time.UTC)
+	to := time.Date(2021, 5, 6, 7, 0, 0, 0, time.UTC)
+	full := &stats{Name: "alice", Timezone: "UTC", Tweets: 2, From: &from, To: &to, Months: map[string]int{"2020-01": 1, "2021-05": 1}, Years: map[string]int{"2020": 1, "2021": 1}}
+	full.Hours[3], full.Hours[7] = 1, 1
+	full.Weekdays[from.Weekday()]++
+	full.Weekdays[to.Weekday()]++
+	// E.g. -since after the last tweet.
+	empty := &stats{Name: "bob", Timezone: "UTC", Months: map[string]int{}, Years: map[string]int{}}
+	data := []struct {
+		l    []*stats
+		want []string
+	}{
+		{[]*stats{empty}, []string{"bob-hours.png", "bob-weekdays.png"}},
+		{[]*stats{full, empty}, []string{"alice-hours.png", "alice-weekdays.png", "alice-years.png", "alice-months.png", "bob-hours.png", "bob-weekdays.png"}},
+	}
+	for i, l := range data {
+		dir := t.TempDir()
+		files, err := writePNG(dir, l.l)
+		if err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
+		if len(files) != len(l.want) {
+			t.Fatalf("#%d: got %q; want %q", i, files, l.want)
+		}
+		for j, f := range files {
+			if f != filepath.Join(dir, l.want[j]) {
+				t.Errorf("#%d: got %q; want %q", i, f, l.want[j])
+			}
+			// The charts are meant to be shared.
+			if fi, err := os.Stat(f); err != nil {
+				t.Errorf("#%d: %v", i, err)
+			} else if m := fi.Mode().Perm(); m != 0644 && runtime.GOOS != "windows" {
+				t.Errorf("#%d: %s has mode %o", i, f, m)
+			}
+		}
+	}
+}
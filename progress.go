@@ -0,0 +1,173 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"golang.org/x/term"
+)
+
+// progress is a status line on stderr updated during a fetch, so long
+// backfills don't look hung. All its methods are no-op on a nil progress.
+type progress struct {
+	start time.Time
+	done  chan struct{}
+
+	mu sync.Mutex
+	// users is the number of users to fetch and fetched how many are done.
+	users   int
+	fetched int
+	// active is the number of pages fetched so far of the users in progress.
+	active map[string]int
+	pages  int
+	tweets int
+	// waitUntil is set while sleeping for a quota to reset.
+	waitUntil time.Time
+	// shown is set when the line needs to be cleared.
+	shown bool
+}
+
+// fetchProgress is the progress of the fetch in progress, if any.
+var fetchProgress *progress
+
+// startProgress starts printing the progress of a fetch of users. It returns
+// nil when stderr is not a terminal or when the info logs are printed since
+// they would keep scrolling the status line away.
+func startProgress(users int) *progress {
+	if !term.IsTerminal(int(os.Stderr.Fd())) || logLevel <= slog.LevelInfo {
+		return nil
+	}
+	p := &progress{start: time.Now(), done: make(chan struct{}), users: users, active: map[string]int{}}
+	go func() {
+		t := time.NewTicker(250 * time.Millisecond)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				p.draw()
+			case <-p.done:
+				return
+			}
+		}
+	}()
+	fetchProgress = p
+	return p
+}
+
+// stop stops printing the progress and clears the line.
+func (p *progress) stop() {
+	if p == nil {
+		return
+	}
+	close(p.done)
+	p.clear()
+	fetchProgress = nil
+}
+
+// begin records that the fetch of name started.
+func (p *progress) begin(name string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.active[name] = 0
+	p.mu.Unlock()
+}
+
+// end records that the fetch of name is done.
+func (p *progress) end(name string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	delete(p.active, name)
+	p.fetched++
+	p.mu.Unlock()
+}
+
+// page records a page of tweets retrieved for name.
+func (p *progress) page(name string, tweets int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.active[name]++
+	p.pages++
+	p.tweets += tweets
+	p.mu.Unlock()
+}
+
+// wait records a sleep for a quota to reset, to count down.
+func (p *progress) wait(d time.Duration) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.waitUntil = time.Now().Add(d)
+	p.mu.Unlock()
+}
+
+// clear erases the status line, e.g. before printing a warning. It is drawn
+// again on the next tick.
+func (p *progress) clear() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.shown {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		p.shown = false
+	}
+}
+
+func (p *progress) draw() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var names []string
+	for n := range p.active {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	if len(names) > 3 {
+		names = append(names[:3], "…")
+	}
+	elapsed := time.Since(p.start)
+	parts := []string{fmt.Sprintf("%d pages, %d tweets, %s elapsed", p.pages, p.tweets, elapsed.Round(time.Second))}
+	if maxPages != 0 && len(p.active) == 1 {
+		for _, n := range p.active {
+			parts = append(parts, fmt.Sprintf("~%d pages left", maxPages-n))
+		}
+	}
+	if p.fetched != 0 && p.fetched < p.users {
+		eta := elapsed / time.Duration(p.fetched) * time.Duration(p.users-p.fetched)
+		parts = append(parts, fmt.Sprintf("~%s left", eta.Round(time.Second)))
+	}
+	if d := time.Until(p.waitUntil); d > 0 {
+		parts = append(parts, fmt.Sprintf("waiting %s for the quota", d.Round(time.Second)))
+	}
+	line := "Fetching"
+	if len(names) != 0 {
+		line += " " + strings.Join(names, ", ")
+	}
+	if p.users > 1 {
+		line += fmt.Sprintf(" (%d/%d users)", p.fetched, p.users)
+	}
+	line += ": " + strings.Join(parts, ", ")
+	if w, _, err := term.GetSize(int(os.Stderr.Fd())); err == nil && w > 1 {
+		if r := []rune(line); len(r) >= w {
+			line = string(r[:w-1])
+		}
+	}
+	fmt.Fprint(os.Stderr, "\r\033[K"+line)
+	p.shown = true
+}
@@ -0,0 +1,62 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/exp/slog"
+)
+
+// registerProxy registers -proxy on f.
+func registerProxy(f *flag.FlagSet) *string {
+	return f.String("proxy", "", "proxy URL for all the requests, e.g. socks5://127.0.0.1:9050; defaults to $HTTPS_PROXY and $HTTP_PROXY")
+}
+
+// setProxy routes all the requests through the proxy p, if not empty.
+//
+// All the clients, including anaconda's, use http.DefaultTransport, which
+// already honors the HTTP_PROXY and HTTPS_PROXY environment variables.
+func setProxy(p string) error {
+	if len(p) == 0 {
+		return nil
+	}
+	u, err := url.Parse(p)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("unsupported -proxy %q; expected http, https or socks5", p)
+	}
+	t, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return fmt.Errorf("cannot set a proxy on %T", http.DefaultTransport)
+	}
+	slog.Debug("Using proxy", "proxy", u.Redacted())
+	t.Proxy = http.ProxyURL(u)
+	return nil
+}
+
+// errOffline is returned by the requests done while offline.
+var errOffline = errors.New("network access is disabled")
+
+// offlineTransport fails all the requests.
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("%s: %w", req.URL.Host, errOffline)
+}
+
+// goOffline makes all the requests fail, so nothing is sent even when
+// credentials are available.
+func goOffline() {
+	http.DefaultTransport = offlineTransport{}
+}
@@ -0,0 +1,109 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// compacter is implemented by the Stores that keep the tweets removed on disk,
+// in unused pages or in a backup.
+type compacter interface {
+	// Compact reclaims the unused space. The pending changes must be flushed.
+	Compact() error
+}
+
+// parseAge parses a duration that also accepts days (d), weeks (w) and years
+// (y), e.g. "90d" or "2y".
+func parseAge(s string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour, "y": 365 * 24 * time.Hour}
+	for u, d := range units {
+		if n := strings.TrimSuffix(s, u); n != s {
+			f, err := strconv.ParseFloat(n, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(f * float64(d)), nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
+// pruneCache removes the tweets older than a retention window.
+func pruneCache(args []string) error {
+	f := flag.NewFlagSet("prune", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "usage: restroom prune -older-than <age> [-u <user>]\n")
+		f.PrintDefaults()
+	}
+	olderThan := f.String("older-than", "", "remove the tweets older than this, e.g. 90d or 2y")
+	user := f.String("u", "", "only prune this user")
+	registerStore(f)
+	logs := registerLog(f)
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+
+	if err := logs.apply(); err != nil {
+		return err
+	}
+	if f.NArg() != 0 {
+		return errors.New("unexpected argument")
+	}
+	if len(*olderThan) == 0 {
+		return errors.New("-older-than is required")
+	}
+	age, err := parseAge(*olderThan)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-age)
+
+	c := load()
+	keys := []string{c.resolve(*user)}
+	if len(*user) == 0 {
+		if keys, err = c.store.Users(); err != nil {
+			return err
+		}
+	}
+	total := 0
+	for _, k := range keys {
+		l := c.get(k)
+		kept := make([]Tweet, 0, len(l))
+		for _, t := range l {
+			if !t.CreatedAt.Before(cutoff) {
+				kept = append(kept, t)
+			}
+		}
+		if len(kept) == len(l) {
+			continue
+		}
+		slog.Info("Removing tweets", "user", k, "count", len(l)-len(kept))
+		total += len(l) - len(kept)
+		if err := c.store.RemoveUser(k); err != nil {
+			return err
+		}
+		if len(kept) != 0 {
+			if err := c.store.AppendTweets(k, kept); err != nil {
+				return err
+			}
+		}
+	}
+	c.save()
+	if cp, ok := c.store.(compacter); ok && total != 0 {
+		if err := cp.Compact(); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Removed %d tweets older than %s\n", total, cutoff.Format("2006-01-02"))
+	return nil
+}
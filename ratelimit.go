@@ -0,0 +1,254 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// waitLimits is set with -wait.
+var waitLimits bool
+
+// maxShortWait is the longest restroom sleeps for a quota without -wait.
+const maxShortWait = time.Minute
+
+// errRateLimited is returned when the quota is used up and waiting for it
+// requires -wait.
+var errRateLimited = errors.New("rate limit reached")
+
+// sleepFor sleeps for d, unless d is long and -wait is not set.
+func sleepFor(ctx context.Context, d time.Duration, why string) error {
+	if d > maxShortWait && !waitLimits {
+		return fmt.Errorf("%w: %s for %s; rerun later or use -wait", errRateLimited, why, d.Round(time.Second))
+	}
+	slog.Info("Sleeping", "reason", why, "duration", d.Round(time.Second))
+	fetchProgress.wait(d)
+	return sleep(ctx, d)
+}
+
+// sleep sleeps for d or until ctx is canceled.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimitTransport paces the requests with the X-Rate-Limit-Remaining and
+// X-Rate-Limit-Reset headers returned by the Twitter API for each endpoint.
+// Once an endpoint's quota is used up, the next request waits for the reset,
+// and a request rejected with 429 is retried after the reset.
+type rateLimitTransport struct {
+	mu     sync.Mutex
+	resets map[string]time.Time
+}
+
+// apiTransport is shared by all the clients so they share what is known about
+// the quotas. The transient errors are retried.
+var apiTransport = &retryTransport{base: &rateLimitTransport{resets: map[string]time.Time{}}}
+
+// apiClient is the HTTP client to use for API calls.
+var apiClient = &http.Client{Transport: apiTransport}
+
+func (r *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.URL.Host + req.URL.Path
+	for {
+		r.mu.Lock()
+		reset := r.resets[key]
+		r.mu.Unlock()
+		if d := time.Until(reset); d > 0 {
+			if err := sleepFor(req.Context(), d, "quota of "+req.URL.Path+" used up"); err != nil {
+				return nil, err
+			}
+		}
+		// Use the current transport, in case -proxy changed it.
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		reset, usedUp := quotaReset(resp)
+		r.mu.Lock()
+		if usedUp {
+			r.resets[key] = reset
+		} else {
+			delete(r.resets, key)
+		}
+		r.mu.Unlock()
+		if resp.StatusCode != http.StatusTooManyRequests || !usedUp || (req.Body != nil && req.Body != http.NoBody) {
+			return resp, nil
+		}
+		resp.Body.Close()
+	}
+}
+
+// quotaReset returns when the quota resets if it is used up.
+func quotaReset(resp *http.Response) (time.Time, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.Header.Get("X-Rate-Limit-Remaining") != "0" {
+		return time.Time{}, false
+	}
+	s, err := strconv.ParseInt(resp.Header.Get("X-Rate-Limit-Reset"), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	t := time.Unix(s, 0)
+	return t, time.Until(t) > 0
+}
+
+// windowLimiter allows up to n requests per sliding window, as documented by
+// most APIs, e.g. "300 requests / 15 minutes".
+//
+// Unlike a token bucket that starts empty, the first n requests are not
+// delayed.
+type windowLimiter struct {
+	n      int
+	window time.Duration
+
+	// store and name are set when the requests are recorded across runs.
+	store *limiterStore
+	name  string
+
+	mu   sync.Mutex
+	last []time.Time
+}
+
+func newWindowLimiter(n int, window time.Duration) *windowLimiter {
+	return &windowLimiter{n: n, window: window}
+}
+
+// limiter returns the windowLimiter named name, starting with the requests
+// recorded by previous runs. The same limiter is returned for the same name so
+// concurrent fetches share the quota.
+func (s *limiterStore) limiter(name string, n int, window time.Duration) *windowLimiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w := s.limiters[name]; w != nil {
+		return w
+	}
+	w := &windowLimiter{n: n, window: window, store: s, name: name}
+	s.limiters[name] = w
+	for _, t := range s.requests[name] {
+		if time.Since(t) < window {
+			w.last = append(w.last, t)
+		}
+	}
+	if len(w.last) > n {
+		w.last = w.last[len(w.last)-n:]
+	}
+	return w
+}
+
+// wait blocks until a request can be done without busting the quota. It
+// returns errRateLimited if that's too long without -wait.
+func (w *windowLimiter) wait(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.last) == w.n {
+		if d := time.Until(w.last[0].Add(w.window)); d > 0 {
+			if err := sleepFor(ctx, d, fmt.Sprintf("quota of %d requests per %s used", w.n, w.window)); err != nil {
+				return err
+			}
+		}
+		w.last = w.last[1:]
+	}
+	w.last = append(w.last, time.Now())
+	if w.store != nil {
+		w.store.set(w.name, w.last)
+	}
+	return nil
+}
+
+// status returns the number of requests left in the current window and, if
+// some were done, when the oldest of them stops counting.
+func (w *windowLimiter) status() (int, time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var oldest time.Time
+	n := 0
+	for _, t := range w.last {
+		if time.Since(t) < w.window {
+			if n == 0 {
+				oldest = t.Add(w.window)
+			}
+			n++
+		}
+	}
+	return w.n - n, oldest
+}
+
+// limiterStore records the requests done by windowLimiters in the user's cache
+// directory, so consecutive runs with the same credentials share the quota.
+type limiterStore struct {
+	path string
+
+	mu       sync.Mutex
+	requests map[string][]time.Time
+	limiters map[string]*windowLimiter
+}
+
+var (
+	limiterStoreOnce sync.Once
+	limiterStoreInst *limiterStore
+)
+
+// openLimiterStore loads the requests recorded by previous runs. Errors are
+// ignored since the worst case is being throttled by the server.
+//
+// It is loaded once per process.
+func openLimiterStore() *limiterStore {
+	limiterStoreOnce.Do(func() {
+		limiterStoreInst = loadLimiterStore()
+	})
+	return limiterStoreInst
+}
+
+func loadLimiterStore() *limiterStore {
+	s := &limiterStore{requests: map[string][]time.Time{}, limiters: map[string]*windowLimiter{}}
+	d, err := os.UserCacheDir()
+	if err != nil {
+		slog.Warn("Rate limits are not persisted", "err", err)
+		return s
+	}
+	s.path = filepath.Join(d, "restroom", "ratelimits.json")
+	if b, err := ioutil.ReadFile(s.path); err == nil {
+		if err := json.Unmarshal(b, &s.requests); err != nil {
+			slog.Warn("Ignoring the recorded rate limits", "file", s.path, "err", err)
+		}
+	}
+	return s
+}
+
+func (s *limiterStore) set(name string, last []time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests[name] = append([]time.Time(nil), last...)
+	if len(s.path) == 0 {
+		return
+	}
+	b, err := json.Marshal(s.requests)
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(s.path), 0700); err == nil {
+			err = writeFileAtomic(s.path, b, 0600, false)
+		}
+	}
+	if err != nil {
+		slog.Warn("Rate limits are not persisted", "err", err)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+func init() {
+	registerSource("reddit", sourceDef{
+		new: func(cred *credentials) Source {
+			// Anonymous clients are limited to 10 requests per minute.
+			return &redditSource{limit: openLimiterStore().limiter("reddit", 10, time.Minute)}
+		},
+	})
+}
+
+type redditListing struct {
+	Data struct {
+		After    string `json:"after"`
+		Children []struct {
+			Kind string `json:"kind"`
+			Data struct {
+				ID         string  `json:"id"`
+				CreatedUTC float64 `json:"created_utc"`
+				Subreddit  string  `json:"subreddit"`
+			} `json:"data"`
+		} `json:"children"`
+	} `json:"data"`
+}
+
+// redditSource fetches the submissions and comments of a reddit user. No
+// authentication is needed.
+//
+// The subreddit is stored as the place.
+type redditSource struct {
+	limit *windowLimiter
+}
+
+func (r *redditSource) Key(user string) string {
+	return "reddit:" + user
+}
+
+// redditID packs a reddit ID into an int64. Comments (t1) and submissions (t3)
+// have distinct ID spaces so the lowest bit is set for comments.
+func redditID(kind, id string) (int64, error) {
+	i, err := strconv.ParseInt(id, 36, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid reddit id %q: %w", id, err)
+	}
+	i <<= 1
+	if kind == "t1" {
+		i |= 1
+	}
+	return i, nil
+}
+
+// redditFullname is the reverse of redditID, as used in "after".
+func redditFullname(id int64) string {
+	kind := "t3_"
+	if id&1 != 0 {
+		kind = "t1_"
+	}
+	return kind + strconv.FormatInt(id>>1, 36)
+}
+
+func (r *redditSource) Fetch(ctx context.Context, user string, cached []Tweet) ([]Tweet, error) {
+	// https://www.reddit.com/dev/api#GET_user_{username}_overview
+	// - "limit" is limited to 100.
+	// - Listings stop after 1000 items.
+	// - Anonymous clients are limited to 10 requests per minute.
+	v := url.Values{"limit": {strconv.Itoa(pageLen(100))}, "raw_json": {"1"}}
+	if last, ok := oldest(cached); ok {
+		a := redditFullname(last.Id)
+		slog.Debug("Using after", "after", a)
+		v.Set("after", a)
+	}
+	var out []Tweet
+	for i := 0; i < pageCount(10) && !enough(len(out)); i++ {
+		if err := r.limit.wait(ctx); err != nil {
+			return out, err
+		}
+		slog.Debug("Fetching")
+		var l redditListing
+		h, err := getJSONHeader(ctx, "https://www.reddit.com/user/"+url.PathEscape(user)+"/overview.json?"+v.Encode(), "", &l)
+		if err != nil {
+			// The transient errors were already retried.
+			return out, err
+		}
+		slog.Debug("Retrieved items", "count", len(l.Data.Children))
+		for _, c := range l.Data.Children {
+			id, err := redditID(c.Kind, c.Data.ID)
+			if err != nil {
+				return nil, err
+			}
+			t := time.Unix(int64(c.Data.CreatedUTC), 0).UTC()
+			out = append(out, Tweet{CreatedAt: t, Id: id, Place: "r/" + c.Data.Subreddit})
+		}
+		if len(l.Data.After) == 0 {
+			break
+		}
+		v.Set("after", l.Data.After)
+		// Wait for the window to reset when the quota is exhausted.
+		if rem, err := strconv.ParseFloat(h.Get("X-Ratelimit-Remaining"), 64); err == nil && rem < 1 {
+			if reset, err := strconv.Atoi(h.Get("X-Ratelimit-Reset")); err == nil {
+				slog.Info("Rate limited; sleeping", "seconds", reset)
+				if err := sleep(ctx, time.Duration(reset)*time.Second); err != nil {
+					return out, err
+				}
+			}
+		}
+	}
+	return out, nil
+}
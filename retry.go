@@ -0,0 +1,64 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// maxAttempts is set with -max-attempts.
+var maxAttempts = 4
+
+// retryTransport retries the requests that failed with a network error or a
+// 5xx status, with a jittered exponential backoff. Other statuses like 401,
+// 403 and 404 are returned as-is since retrying would not help.
+type retryTransport struct {
+	base http.RoundTripper
+}
+
+func (r *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Only the requests without a body can be sent again.
+	retriable := req.Body == nil || req.Body == http.NoBody
+	for attempt := 1; ; attempt++ {
+		resp, err := r.base.RoundTrip(req)
+		if !retriable || attempt >= maxAttempts || !isTransient(resp, err) {
+			return resp, err
+		}
+		d := backoff(attempt)
+		if err != nil {
+			slog.Warn("Retrying", "path", req.URL.Path, "err", err, "in", d.Round(time.Millisecond))
+		} else {
+			slog.Warn("Retrying", "path", req.URL.Path, "status", resp.Status, "in", d.Round(time.Millisecond))
+			resp.Body.Close()
+		}
+		if err := sleep(req.Context(), d); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// isTransient returns true if the request may succeed when retried.
+func isTransient(resp *http.Response, err error) bool {
+	if err != nil {
+		// The quota is handled by rateLimitTransport.
+		return !errors.Is(err, errRateLimited)
+	}
+	return resp.StatusCode >= 500
+}
+
+// backoff returns how long to wait before the next attempt: 1s, 2s, 4s, etc,
+// up to a minute, ±50% so concurrent clients don't retry in lockstep.
+func backoff(attempt int) time.Duration {
+	d := time.Second << uint(attempt-1)
+	if d > time.Minute || d <= 0 {
+		d = time.Minute
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)))
+}
@@ -0,0 +1,184 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// feed is either a RSS 2.0 or an Atom feed.
+type feed struct {
+	Items   []feedEntry `xml:"channel>item"`
+	Entries []feedEntry `xml:"entry"`
+}
+
+type feedEntry struct {
+	// RSS.
+	GUID    string `xml:"guid"`
+	PubDate string `xml:"pubDate"`
+	// Atom.
+	ID        string `xml:"id"`
+	Published string `xml:"published"`
+	Updated   string `xml:"updated"`
+}
+
+// reStatus extracts the tweet ID from a Nitter (or twitter) status URL.
+var reStatus = regexp.MustCompile(`/status/(\d+)`)
+
+// feedDateLayouts are the formats seen in the wild for RSS and Atom dates.
+var feedDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+}
+
+func parseFeedDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, l := range feedDateLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown date format %q", s)
+}
+
+// hashID derives a stable positive ID from a string, for sources that do not
+// have numeric IDs.
+func hashID(s string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return int64(h.Sum64() & math.MaxInt64)
+}
+
+// toTweet converts an entry. The tweet ID is used when it is a link to a
+// status, otherwise the entry's GUID is hashed.
+func (e *feedEntry) toTweet() (Tweet, error) {
+	d := e.PubDate
+	if len(d) == 0 {
+		d = e.Published
+	}
+	if len(d) == 0 {
+		d = e.Updated
+	}
+	t, err := parseFeedDate(d)
+	if err != nil {
+		return Tweet{}, err
+	}
+	guid := strings.TrimSpace(e.GUID)
+	if len(guid) == 0 {
+		guid = strings.TrimSpace(e.ID)
+	}
+	if m := reStatus.FindStringSubmatch(guid); m != nil {
+		if id, err := strconv.ParseInt(m[1], 10, 64); err == nil {
+			return Tweet{CreatedAt: t, Id: id}, nil
+		}
+	}
+	return Tweet{CreatedAt: t, Id: hashID(guid)}, nil
+}
+
+func init() {
+	registerSource("nitter", sourceDef{
+		flags: func(f *flag.FlagSet) {
+			f.StringVar(&nitterInstance, "nitter", "https://nitter.net", "nitter instance to use with -source nitter")
+		},
+		new: func(cred *credentials) Source { return &nitterSource{} },
+	})
+	registerSource("rss", sourceDef{
+		flags: func(f *flag.FlagSet) {
+			f.StringVar(&feedURL, "feed", "", "RSS or Atom feed to use with -source rss")
+		},
+		new: func(cred *credentials) Source { return &feedSource{} },
+	})
+}
+
+var (
+	nitterInstance string
+	feedURL        string
+)
+
+// nitterSource fetches the most recent tweets from the RSS feed of a Nitter
+// instance.
+type nitterSource struct{}
+
+// Key returns the same key as the twitter source, since Nitter exposes the
+// real tweet IDs.
+func (n *nitterSource) Key(user string) string {
+	return user
+}
+
+func (n *nitterSource) Fetch(ctx context.Context, user string, cached []Tweet) ([]Tweet, error) {
+	return fetchFeed(ctx, strings.TrimSuffix(nitterInstance, "/")+"/"+url.PathEscape(user)+"/rss")
+}
+
+// feedSource fetches the entries of any RSS or Atom feed, stored under the
+// user name provided.
+type feedSource struct{}
+
+func (f *feedSource) Key(user string) string {
+	return "rss:" + user
+}
+
+func (f *feedSource) Fetch(ctx context.Context, user string, cached []Tweet) ([]Tweet, error) {
+	if len(feedURL) == 0 {
+		return nil, errors.New("-feed is required with -source rss")
+	}
+	return fetchFeed(ctx, feedURL)
+}
+
+// fetchFeed fetches a RSS or Atom feed and returns its entries.
+//
+// Feeds are not paginated so only the most recent entries are retrieved on
+// each run.
+func fetchFeed(ctx context.Context, u string) ([]Tweet, error) {
+	slog.Debug("Fetching", "url", u)
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{url: u, code: resp.StatusCode, status: resp.Status}
+	}
+	var f feed
+	if err := xml.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", u, err)
+	}
+	entries := append(f.Items, f.Entries...)
+	slog.Debug("Retrieved entries", "count", len(entries))
+	out := make([]Tweet, 0, len(entries))
+	for i := range entries {
+		t, err := entries[i].toTweet()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
@@ -0,0 +1,258 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// shardStore is a Store with one JSON file per key in a directory, so only
+// the users queried are loaded and only the users updated are rewritten.
+//
+// The metadata and the version are in meta.json. The files are encrypted if
+// meta.json was already or with -encrypt.
+type shardStore struct {
+	dir     string
+	meta    *cacheMeta
+	users   map[string][]Tweet
+	dirty   map[string]bool
+	removed map[string]bool
+	encrypt bool
+	// plain is set when the files on disk are not encrypted.
+	plain bool
+}
+
+// shardMeta is the format of meta.json.
+type shardMeta struct {
+	Version int
+	// Restroom is the version of restroom that last wrote the shards.
+	Restroom string `json:",omitempty"`
+	cacheMeta
+}
+
+// openShardStore opens or creates a directory of shards. When the directory
+// doesn't exist yet, the restroom.json next to it is imported into it.
+func openShardStore(dir string) (*shardStore, error) {
+	s := &shardStore{
+		dir:     dir,
+		meta:    newCacheMeta(),
+		users:   map[string][]Tweet{},
+		dirty:   map[string]bool{},
+		removed: map[string]bool{},
+		encrypt: encryptCache,
+	}
+	b, _, enc, err := readCacheFile(filepath.Join(dir, "meta.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		if readOnlyCache {
+			return s, nil
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		return s, importJSON(s, filepath.Join(filepath.Dir(dir), "restroom.json"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.encrypt = s.encrypt || enc
+	s.plain = !enc
+	var m shardMeta
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+	if m.Version > cacheVersion {
+		return nil, errNewerCache(m.Version)
+	}
+	if m.Fetched != nil {
+		s.meta.Fetched = m.Fetched
+	}
+	if m.Aliases != nil {
+		s.meta.Aliases = m.Aliases
+	}
+	if m.Cursors != nil {
+		s.meta.Cursors = m.Cursors
+	}
+	if m.Timezones != nil {
+		s.meta.Timezones = m.Timezones
+	}
+	return s, nil
+}
+
+// shardName returns the file name for key. The characters that are not safe
+// in file names on all OSes are escaped, as is the first one of "meta" so the
+// user doesn't overwrite meta.json.
+func shardName(key string) string {
+	var b strings.Builder
+	for i, c := range []byte(key) {
+		if (c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == '@') && (i != 0 || key != "meta") {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String() + ".json"
+}
+
+// shardKey is the reverse of shardName.
+func shardKey(name string) (string, bool) {
+	name = strings.TrimSuffix(name, ".json")
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '%' {
+			b.WriteByte(name[i])
+			continue
+		}
+		var c byte
+		if i+2 >= len(name) {
+			return "", false
+		}
+		if _, err := fmt.Sscanf(name[i+1:i+3], "%02X", &c); err != nil {
+			return "", false
+		}
+		b.WriteByte(c)
+		i += 2
+	}
+	return b.String(), true
+}
+
+func (s *shardStore) Users() ([]string, error) {
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, e := range entries {
+		if n := e.Name(); strings.HasSuffix(n, ".json") && n != "meta.json" {
+			if k, ok := shardKey(n); ok && !s.removed[k] {
+				seen[k] = true
+			}
+		}
+	}
+	for k := range s.dirty {
+		seen[k] = true
+	}
+	out := make([]string, 0, len(seen))
+	for k := range seen {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func (s *shardStore) LoadUser(key string) ([]Tweet, error) {
+	if l, ok := s.users[key]; ok || s.removed[key] {
+		return l, nil
+	}
+	b, _, _, err := readCacheFile(filepath.Join(s.dir, shardName(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var l []Tweet
+	if err := json.Unmarshal(b, &l); err != nil {
+		return nil, fmt.Errorf("%s: %w", shardName(key), err)
+	}
+	s.users[key] = l
+	return l, nil
+}
+
+func (s *shardStore) AppendTweets(key string, tweets []Tweet) error {
+	l, err := s.LoadUser(key)
+	if err != nil {
+		return err
+	}
+	m := memStore{users: map[string][]Tweet{key: l}}
+	if err := m.AppendTweets(key, tweets); err != nil {
+		return err
+	}
+	s.users[key] = m.users[key]
+	s.dirty[key] = true
+	delete(s.removed, key)
+	return nil
+}
+
+func (s *shardStore) RemoveUser(key string) error {
+	delete(s.users, key)
+	delete(s.dirty, key)
+	s.removed[key] = true
+	return nil
+}
+
+// UserSize implements userSizer.
+func (s *shardStore) UserSize(key string) (int64, error) {
+	fi, err := os.Stat(filepath.Join(s.dir, shardName(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (s *shardStore) Meta() (*cacheMeta, error) {
+	return s.meta, nil
+}
+
+func (s *shardStore) SetMeta(m *cacheMeta) error {
+	s.meta = m
+	return nil
+}
+
+func (s *shardStore) Flush() error {
+	if s.encrypt && s.plain {
+		// Encrypt all the existing shards.
+		keys, err := s.Users()
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if _, err := s.LoadUser(k); err != nil {
+				return err
+			}
+			s.dirty[k] = true
+		}
+		s.plain = false
+	}
+	for k := range s.removed {
+		if err := os.Remove(filepath.Join(s.dir, shardName(k))); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	for k := range s.dirty {
+		b, err := json.Marshal(s.users[k])
+		if err != nil {
+			return err
+		}
+		if b, err = encodeCacheFile(b, false, s.encrypt); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(filepath.Join(s.dir, shardName(k)), b, 0600, false); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(&shardMeta{Version: cacheVersion, Restroom: version(), cacheMeta: *s.meta})
+	if err != nil {
+		return err
+	}
+	if b, err = encodeCacheFile(b, false, s.encrypt); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(s.dir, "meta.json"), b, 0600, false); err != nil {
+		return err
+	}
+	s.dirty = map[string]bool{}
+	s.removed = map[string]bool{}
+	return nil
+}
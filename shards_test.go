@@ -0,0 +1,85 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShardName(t *testing.T) {
+	data := []struct {
+		key  string
+		name string
+	}{
+		{"alice", "alice.json"},
+		{"id:12345", "id%3A12345.json"},
+		{"alice/likes", "alice%2Flikes.json"},
+		{"q:#golang lang:en", "q%3A%23golang%20lang%3Aen.json"},
+		{"mastodon:bob@example.com", "mastodon%3Abob@example.com.json"},
+		{"Bob_1-x.y", "Bob_1-x.y.json"},
+		{"100%", "100%25.json"},
+		{"é", "%C3%A9.json"},
+		// meta.json is the metadata.
+		{"meta", "%6Deta.json"},
+		{"Meta", "Meta.json"},
+		{"metas", "metas.json"},
+		{"meta.json", "meta.json.json"},
+	}
+	for i, l := range data {
+		if n := shardName(l.key); n != l.name {
+			t.Errorf("#%d: shardName(%q) = %q; want %q", i, l.key, n, l.name)
+		}
+		if k, ok := shardKey(l.name); !ok || k != l.key {
+			t.Errorf("#%d: shardKey(%q) = %q, %t; want %q", i, l.name, k, ok, l.key)
+		}
+	}
+}
+
+func TestShardKeyInvalid(t *testing.T) {
+	for i, n := range []string{"a%.json", "a%4.json", "a%ZZ.json"} {
+		if k, ok := shardKey(n); ok {
+			t.Errorf("#%d: shardKey(%q) = %q; want an error", i, n, k)
+		}
+	}
+}
+
+func TestShardStoreMeta(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openShardStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := s.AppendTweets("meta", []Tweet{{CreatedAt: now, Id: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	m, _ := s.Meta()
+	m.Fetched["meta"] = now
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err = openShardStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := s.Users()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "meta" {
+		t.Fatalf("Users() = %q", keys)
+	}
+	l, err := s.LoadUser("meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l) != 1 || l[0].Id != 1 {
+		t.Fatalf("LoadUser() = %v", l)
+	}
+	if m, _ = s.Meta(); !m.Fetched["meta"].Equal(now) {
+		t.Fatalf("Fetched = %v", m.Fetched)
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// Source is a platform posts can be fetched from.
+type Source interface {
+	// Key returns the cache key to store user's posts under.
+	Key(user string) string
+	// Fetch returns the posts of user that are not in cached yet.
+	//
+	// cached is sorted from the most recent to the oldest post. Fetch returns
+	// errNoCredentials if the source cannot be queried without credentials and
+	// none were provided. It stops early with ctx's error when ctx is canceled.
+	Fetch(ctx context.Context, user string, cached []Tweet) ([]Tweet, error)
+}
+
+// Searcher is implemented by the sources that can collect the posts matching
+// a query, selected with -q.
+type Searcher interface {
+	// Search returns the posts matching query that are not in cached yet.
+	Search(ctx context.Context, query string, cached []Tweet) ([]Tweet, error)
+}
+
+// Lister is implemented by the sources that can enumerate the members of a
+// list of users, selected with -list.
+type Lister interface {
+	// Members returns the users in list.
+	Members(ctx context.Context, list string) ([]string, error)
+}
+
+// Resolver is implemented by the sources where users have an immutable ID in
+// addition to a name that can change.
+type Resolver interface {
+	// Resolve returns the immutable ID of user, to be passed to Key. It returns
+	// errNoCredentials if the source cannot be queried.
+	Resolve(ctx context.Context, user string) (string, error)
+}
+
+// Timezoner is implemented by the Resolvers that find the timezone of the
+// users in their profile.
+type Timezoner interface {
+	// Timezone returns the timezone of the user last resolved, as accepted by
+	// -tz, or "" if the profile doesn't set it.
+	Timezone() string
+}
+
+// Pager is implemented by the sources that fetch in pages, so each page can be
+// saved as soon as it is retrieved and an interrupted fetch resumed.
+type Pager interface {
+	// OnPage sets the function called with each page, before Fetch or Search
+	// returns all of them. cursor is where to resume from if the fetch is
+	// interrupted after this page, or empty if there is no need to.
+	OnPage(f func(tweets []Tweet, cursor string))
+	// Resume sets the cursor of an interrupted fetch to resume from.
+	Resume(cursor string)
+}
+
+// pager implements Pager for the sources to embed.
+type pager struct {
+	onPage func(tweets []Tweet, cursor string)
+	resume string
+	// cursor is the last cursor passed to onPage.
+	cursor string
+}
+
+func (p *pager) OnPage(f func(tweets []Tweet, cursor string)) {
+	p.onPage = f
+}
+
+func (p *pager) Resume(cursor string) {
+	p.resume = cursor
+	p.cursor = ""
+}
+
+// page passes a page to the function set with OnPage, if any.
+func (p *pager) page(tweets []Tweet, cursor string) {
+	p.cursor = cursor
+	if p.onPage != nil {
+		p.onPage(tweets, cursor)
+	}
+}
+
+// Verifier is implemented by the sources that can tell which posts were
+// deleted, selected with -check-deleted.
+type Verifier interface {
+	// Existing returns the subset of ids that still exist.
+	Existing(ctx context.Context, ids []int64) (map[int64]bool, error)
+}
+
+// errNoCredentials is returned by Source.Fetch when no credentials were
+// provided. The cached data is used as-is.
+var errNoCredentials = errors.New("no credentials provided")
+
+// accountError is returned by Source.Fetch or Resolver.Resolve when the posts
+// of the account cannot be retrieved, e.g. because it is protected, so the
+// other users can still be fetched.
+type accountError struct {
+	// reason completes "<user> ...", e.g. "is protected".
+	reason string
+	err    error
+}
+
+func (e *accountError) Error() string {
+	return e.reason + ": " + e.err.Error()
+}
+
+func (e *accountError) Unwrap() error {
+	return e.err
+}
+
+// statusError is returned when an API replies with an unexpected HTTP status.
+type statusError struct {
+	url    string
+	code   int
+	status string
+	body   []byte
+}
+
+func (e *statusError) Error() string {
+	if len(e.body) == 0 {
+		return e.url + ": " + e.status
+	}
+	return fmt.Sprintf("%s: %s: %s", e.url, e.status, e.body)
+}
+
+// asAccountError returns the accountError in err, or the one implied by its
+// HTTP status, if any.
+//
+// 401 is not considered since most APIs return it for invalid credentials;
+// the sources where it means the account is protected return an accountError.
+func asAccountError(err error) *accountError {
+	var a *accountError
+	if errors.As(err, &a) {
+		return a
+	}
+	var s *statusError
+	if errors.As(err, &s) {
+		switch s.code {
+		case http.StatusForbidden:
+			return &accountError{reason: "is suspended", err: err}
+		case http.StatusNotFound:
+			return &accountError{reason: "doesn't exist", err: err}
+		}
+	}
+	return nil
+}
+
+// credentials are the secrets a Source may need.
+type credentials struct {
+	ConsumerKey    string
+	ConsumerSecret string
+	Token          string
+	TokenSecret    string
+	Bearer         string
+	// Profile is the named profile of the credentials file to fill the missing
+	// values from.
+	Profile string
+}
+
+// appOnly returns true if only an app-only bearer token is available.
+func (c *credentials) appOnly() bool {
+	return len(c.Bearer) != 0 && len(c.Token) == 0 && len(c.TokenSecret) == 0
+}
+
+// registerCredentials registers the credential flags on f. The values can be
+// "@path" to read the secret from a file.
+func registerCredentials(f *flag.FlagSet) *credentials {
+	cred := &credentials{}
+	f.StringVar(&cred.ConsumerKey, "k", "", "consumer key; defaults to $RESTROOM_CONSUMER_KEY")
+	f.StringVar(&cred.ConsumerSecret, "c", "", "consumer secret; defaults to $RESTROOM_CONSUMER_SECRET")
+	f.StringVar(&cred.Token, "t", "", "access token, optional for github and mastodon; defaults to $RESTROOM_TOKEN")
+	f.StringVar(&cred.TokenSecret, "s", "", "access token secret; defaults to $RESTROOM_TOKEN_SECRET")
+	f.StringVar(&cred.Bearer, "bearer", "", "app-only bearer token, used when -t and -s are not provided; defaults to $RESTROOM_BEARER")
+	f.StringVar(&cred.Profile, "profile", "", "named profile of the credentials file to use; defaults to $RESTROOM_PROFILE")
+	return cred
+}
+
+// sourceDef describes a registered Source.
+type sourceDef struct {
+	// flags registers the source specific flags, if any.
+	flags func(f *flag.FlagSet)
+	// new returns the Source. It is called after the flags are parsed.
+	new func(cred *credentials) Source
+}
+
+var sources = map[string]sourceDef{}
+
+// registerSource registers a Source by name, to be selected with -source.
+func registerSource(name string, d sourceDef) {
+	if _, ok := sources[name]; ok {
+		panic("duplicate source " + name)
+	}
+	sources[name] = d
+}
+
+// sourceNames returns the names of the registered sources, sorted.
+func sourceNames() []string {
+	out := make([]string, 0, len(sources))
+	for n := range sources {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Set with -max-pages, -page-size and -max-tweets. 0 means the source's
+// default.
+var maxPages, pageSize, maxTweets int
+
+// pageCount returns how many pages to request at most in a row, def being the
+// source's default.
+func pageCount(def int) int {
+	if maxPages != 0 {
+		return maxPages
+	}
+	return def
+}
+
+// pageLen returns the number of posts to request per page, max being what the
+// API allows.
+func pageLen(max int) int {
+	if pageSize != 0 && pageSize < max {
+		return pageSize
+	}
+	return max
+}
+
+// enough returns true once n posts were fetched for a user.
+func enough(n int) bool {
+	return maxTweets != 0 && n >= maxTweets
+}
+
+// newest returns the most recent cached post, if any.
+func newest(cached []Tweet) (Tweet, bool) {
+	if len(cached) == 0 {
+		return Tweet{}, false
+	}
+	return cached[0], true
+}
+
+// oldest returns the oldest cached post, if any.
+func oldest(cached []Tweet) (Tweet, bool) {
+	if len(cached) == 0 {
+		return Tweet{}, false
+	}
+	return cached[len(cached)-1], true
+}
@@ -0,0 +1,275 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteStore is a Store in a SQLite database.
+//
+// The tweets are indexed by key and ID so only the users queried are loaded
+// and only the new tweets are written. The changes are done in a transaction
+// committed by Flush.
+type sqliteStore struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+// openSQLiteStore opens or creates a SQLite database. When the database
+// doesn't exist yet, the restroom.json next to it is imported into it.
+func openSQLiteStore(p string) (*sqliteStore, error) {
+	if readOnlyCache {
+		db, err := sql.Open("sqlite", "file:"+p+"?mode=ro")
+		if err != nil {
+			return nil, err
+		}
+		return &sqliteStore{db: db}, nil
+	}
+	_, err := os.Stat(p)
+	migrate := errors.Is(err, os.ErrNotExist)
+	db, err := sql.Open("sqlite", p)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	s := &sqliteStore{db: db}
+	if migrate {
+		if err := importJSON(s, filepath.Join(filepath.Dir(p), "restroom.json")); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// txn returns the pending transaction, starting one if needed.
+func (s *sqliteStore) txn() (*sql.Tx, error) {
+	if s.tx == nil {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return nil, err
+		}
+		s.tx = tx
+	}
+	return s.tx, nil
+}
+
+func (s *sqliteStore) Users() ([]string, error) {
+	tx, err := s.txn()
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	err = scanRows(tx, "SELECT DISTINCT key FROM tweets ORDER BY key", nil, func(rows *sql.Rows) error {
+		var k string
+		err := rows.Scan(&k)
+		out = append(out, k)
+		return err
+	})
+	return out, err
+}
+
+func (s *sqliteStore) LoadUser(key string) ([]Tweet, error) {
+	tx, err := s.txn()
+	if err != nil {
+		return nil, err
+	}
+	var out []Tweet
+	err = scanRows(tx, "SELECT id, created_at, place, text, source, lat, long, exact, likes, retweets, deleted_at, hashtags, mentions, urls, media, kind FROM tweets WHERE key = ?", []interface{}{key}, func(rows *sql.Rows) error {
+		var t Tweet
+		var ts string
+		var lat, long sql.NullFloat64
+		var exact bool
+		var deleted sql.NullString
+		var hashtags, mentions, urls string
+		if err := rows.Scan(&t.Id, &ts, &t.Place, &t.Text, &t.Source, &lat, &long, &exact, &t.Likes, &t.Retweets, &deleted, &hashtags, &mentions, &urls, &t.Media, &t.Kind); err != nil {
+			return err
+		}
+		t.Hashtags = splitList(hashtags)
+		t.Mentions = splitList(mentions)
+		t.URLs = splitList(urls)
+		if deleted.Valid {
+			d, err := time.Parse(time.RFC3339Nano, deleted.String)
+			if err != nil {
+				return err
+			}
+			t.DeletedAt = &d
+		}
+		if lat.Valid && long.Valid {
+			t.Geo = &LatLong{Lat: lat.Float64, Long: long.Float64, Exact: exact}
+		}
+		var err error
+		t.CreatedAt, err = time.Parse(time.RFC3339Nano, ts)
+		out = append(out, t)
+		return err
+	})
+	// The timestamps are stored with their offset so they are not sorted
+	// chronologically by SQLite.
+	sortTweets(out)
+	return out, err
+}
+
+func (s *sqliteStore) AppendTweets(key string, tweets []Tweet) error {
+	tx, err := s.txn()
+	if err != nil {
+		return err
+	}
+	ins, err := tx.Prepare("INSERT OR REPLACE INTO tweets (key, id, created_at, place, text, source, lat, long, exact, likes, retweets, deleted_at, hashtags, mentions, urls, media, kind) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer ins.Close()
+	for _, t := range tweets {
+		var lat, long sql.NullFloat64
+		exact := false
+		if t.Geo != nil {
+			lat = sql.NullFloat64{Float64: t.Geo.Lat, Valid: true}
+			long = sql.NullFloat64{Float64: t.Geo.Long, Valid: true}
+			exact = t.Geo.Exact
+		}
+		var deleted sql.NullString
+		if t.DeletedAt != nil {
+			deleted = sql.NullString{String: t.DeletedAt.Format(time.RFC3339Nano), Valid: true}
+		}
+		if _, err := ins.Exec(key, t.Id, t.CreatedAt.Format(time.RFC3339Nano), t.Place, t.Text, t.Source, lat, long, exact, t.Likes, t.Retweets, deleted, strings.Join(t.Hashtags, " "), strings.Join(t.Mentions, " "), strings.Join(t.URLs, " "), t.Media, t.Kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) RemoveUser(key string) error {
+	tx, err := s.txn()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM tweets WHERE key = ?", key)
+	return err
+}
+
+func (s *sqliteStore) Meta() (*cacheMeta, error) {
+	tx, err := s.txn()
+	if err != nil {
+		return nil, err
+	}
+	m := newCacheMeta()
+	err = scanRows(tx, "SELECT key, at FROM fetched", nil, func(rows *sql.Rows) error {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return err
+		}
+		t, err := time.Parse(time.RFC3339Nano, v)
+		m.Fetched[k] = t
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = scanRows(tx, "SELECT key, canonical FROM aliases", nil, func(rows *sql.Rows) error {
+		var k, v string
+		err := rows.Scan(&k, &v)
+		m.Aliases[k] = v
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = scanRows(tx, "SELECT key, cursor FROM cursors", nil, func(rows *sql.Rows) error {
+		var k, v string
+		err := rows.Scan(&k, &v)
+		m.Cursors[k] = v
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = scanRows(tx, "SELECT key, tz FROM timezones", nil, func(rows *sql.Rows) error {
+		var k, v string
+		err := rows.Scan(&k, &v)
+		m.Timezones[k] = v
+		return err
+	})
+	return m, err
+}
+
+func (s *sqliteStore) SetMeta(m *cacheMeta) error {
+	tx, err := s.txn()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM fetched; DELETE FROM aliases; DELETE FROM cursors; DELETE FROM timezones"); err != nil {
+		return err
+	}
+	for k, t := range m.Fetched {
+		if _, err := tx.Exec("INSERT INTO fetched (key, at) VALUES (?, ?)", k, t.Format(time.RFC3339Nano)); err != nil {
+			return err
+		}
+	}
+	for k, v := range m.Aliases {
+		if _, err := tx.Exec("INSERT INTO aliases (key, canonical) VALUES (?, ?)", k, v); err != nil {
+			return err
+		}
+	}
+	for k, v := range m.Cursors {
+		if _, err := tx.Exec("INSERT INTO cursors (key, cursor) VALUES (?, ?)", k, v); err != nil {
+			return err
+		}
+	}
+	for k, v := range m.Timezones {
+		if _, err := tx.Exec("INSERT INTO timezones (key, tz) VALUES (?, ?)", k, v); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec("INSERT OR REPLACE INTO info (key, value) VALUES ('restroom', ?)", version())
+	return err
+}
+
+func (s *sqliteStore) Flush() error {
+	if s.tx == nil {
+		return nil
+	}
+	err := s.tx.Commit()
+	s.tx = nil
+	return err
+}
+
+// Compact implements compacter.
+func (s *sqliteStore) Compact() error {
+	_, err := s.db.Exec("VACUUM")
+	return err
+}
+
+// scanRows calls f for each row of a query.
+func scanRows(tx *sql.Tx, q string, args []interface{}, f func(rows *sql.Rows) error) error {
+	rows, err := tx.Query(q, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := f(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// splitList splits a space separated list as stored in the tweets table.
+func splitList(s string) []string {
+	if len(s) == 0 {
+		return nil
+	}
+	return strings.Split(s, " ")
+}
@@ -0,0 +1,473 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// statsCmd prints when the users post from the cache, without fetching.
+func statsCmd(args []string) error {
+	f := flag.NewFlagSet("stats", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "usage: restroom stats [-u <user> | -q <query> | -users-file <file>]\n")
+		f.PrintDefaults()
+	}
+	t := registerTargets(f, false)
+	o := registerStats(f, true)
+	registerColor(f)
+	registerStore(f)
+	logs := registerLog(f)
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+
+	if err := logs.apply(); err != nil {
+		return err
+	}
+	if f.NArg() != 0 {
+		return errors.New("unexpected argument")
+	}
+	def, err := t.sourceDef(false)
+	if err != nil {
+		return err
+	}
+	if err := o.parse(); err != nil {
+		return err
+	}
+	// The report is generated from the cache only.
+	goOffline()
+	c := load()
+	defer c.save()
+	keys, err := t.keys(c, def.new(&credentials{}))
+	if err != nil {
+		return err
+	}
+	return o.report(c, t, keys)
+}
+
+// statsOptions are the flags of the stats command.
+type statsOptions struct {
+	combined   bool
+	tz         string
+	since      string
+	until      string
+	output     string
+	out        string
+	lang       string
+	weekStart  string
+	clock      string
+	placesTop  int
+	placesSort string
+	place      string
+	tmpl       string
+	gaps       int
+	hashtags   int
+	partners   int
+
+	// loc is set by parse when -tz is specified.
+	loc *time.Location
+	// placeRe is set by parse when -place is specified.
+	placeRe *regexp.Regexp
+	// template is set by parse when -template is specified.
+	template *template.Template
+}
+
+// registerStats registers the flags of the stats command on f. -o is only
+// registered when withOutput is set, otherwise the output is HTML.
+func registerStats(f *flag.FlagSet, withOutput bool) *statsOptions {
+	o := &statsOptions{output: "html"}
+	f.BoolVar(&o.combined, "combined", false, "with several -u, also print the stats of all the users together")
+	f.StringVar(&o.tz, "tz", "", "timezone to report in, e.g. America/Montreal, UTC-05:00 or local; defaults to the one in the user's profile if known, otherwise UTC")
+	f.StringVar(&o.since, "since", "", "only report on the tweets posted on or after this date, e.g. 2023-01-01")
+	f.StringVar(&o.until, "until", "", "only report on the tweets posted on or before this date, e.g. 2023-06-30")
+	f.StringVar(&o.lang, "lang", "en", "language of the weekday names: "+strings.Join(calendarNames(), ", "))
+	f.StringVar(&o.place, "place", "", "only report on the tweets tagged at a matching place: a name like Montréal, a glob like 'Paris*' or a /regexp/")
+	f.IntVar(&o.hashtags, "hashtags", 10, "number of the most used hashtags to report, overall and per month")
+	f.IntVar(&o.partners, "partners", 10, "number of the accounts mentioned or replied to the most to report")
+	f.IntVar(&o.gaps, "gaps", 3, "number of the largest gaps between two tweets to report")
+	f.IntVar(&o.placesTop, "places-top", 0, "only report the most frequent places; 0 for all of them")
+	f.StringVar(&o.placesSort, "places-sort", "count", "order of the places: count, the most frequent first, or name")
+	f.StringVar(&o.clock, "clock", "24", "label the hours on a 24 or 12-hour clock")
+	f.StringVar(&o.weekStart, "week-start", "", "first day of the week, sunday or monday; defaults to the one of -lang")
+	if withOutput {
+		f.StringVar(&o.output, "o", "text", "output format: "+strings.Join(outputNames(), ", "))
+		f.StringVar(&o.out, "out", ".", "directory to write the charts to, with -o svg or png")
+		f.StringVar(&o.tmpl, "template", "", "text/template file to print the stats with, instead of -o")
+	}
+	return o
+}
+
+// parse validates the flags once parsed.
+func (o *statsOptions) parse() error {
+	if outputs[o.output] == nil && fileOutputs[o.output] == nil {
+		return fmt.Errorf("unknown -o %q", o.output)
+	}
+	if len(o.tmpl) != 0 {
+		var err error
+		if o.template, err = loadTemplate(o.tmpl); err != nil {
+			return fmt.Errorf("-template: %w", err)
+		}
+	}
+	if len(o.tz) != 0 {
+		var err error
+		if o.loc, err = loadLocation(o.tz); err != nil {
+			return fmt.Errorf("-tz: %w", err)
+		}
+	}
+	if _, _, err := o.bounds(time.UTC); err != nil {
+		return err
+	}
+	if len(o.place) != 0 {
+		var err error
+		if o.placeRe, err = compilePlace(o.place); err != nil {
+			return fmt.Errorf("-place: %w", err)
+		}
+	}
+	if o.hashtags < 0 {
+		return errors.New("-hashtags: must be positive")
+	}
+	if o.partners < 0 {
+		return errors.New("-partners: must be positive")
+	}
+	if o.gaps < 0 {
+		return errors.New("-gaps: must be positive")
+	}
+	if o.placesTop < 0 {
+		return errors.New("-places-top: must be positive")
+	}
+	switch o.placesSort {
+	case "count", "name":
+		placesByName = o.placesSort == "name"
+	default:
+		return errors.New("-places-sort: expected count or name")
+	}
+	switch o.clock {
+	case "12", "24":
+		clock12 = o.clock == "12"
+	default:
+		return errors.New("-clock: expected 12 or 24")
+	}
+	return setCalendar(o.lang, o.weekStart)
+}
+
+// loadLocation returns the timezone name, which is either "local", a fixed
+// offset like UTC-05:00 or a name in the IANA database.
+func loadLocation(name string) (*time.Location, error) {
+	if strings.EqualFold(name, "local") {
+		return time.Local, nil
+	}
+	if s := strings.TrimPrefix(name, "UTC"); len(s) != 0 && (s[0] == '+' || s[0] == '-') {
+		t, err := time.Parse("-07:00", s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid offset %q; use UTC-05:00", name)
+		}
+		_, off := t.Zone()
+		return time.FixedZone(name, off), nil
+	}
+	return time.LoadLocation(name)
+}
+
+// compilePlace returns the regexp matching the places selected by pattern.
+// A /regexp/ is used as is. Otherwise the pattern is a case insensitive glob
+// matching the whole name, or a substring of it when it has no wildcard.
+func compilePlace(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		return regexp.Compile(pattern[1 : len(pattern)-1])
+	}
+	if !strings.ContainsAny(pattern, "*?") {
+		return regexp.MustCompile("(?i)" + regexp.QuoteMeta(pattern)), nil
+	}
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// offsetZone returns the name of the fixed timezone at offset seconds from
+// UTC, as accepted by loadLocation.
+func offsetZone(offset int) string {
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	return fmt.Sprintf("UTC%c%02d:%02d", sign, offset/3600, offset/60%60)
+}
+
+// location returns the timezone to report the tweets cached under keys in;
+// without -tz, it is the one in the profile of the users if they all have the
+// same.
+func (o *statsOptions) location(c *cache, keys []string) *time.Location {
+	if o.loc != nil {
+		return o.loc
+	}
+	if len(keys) == 0 {
+		return time.UTC
+	}
+	tz := c.Timezones[keys[0]]
+	for _, k := range keys[1:] {
+		if c.Timezones[k] != tz {
+			return time.UTC
+		}
+	}
+	if len(tz) == 0 {
+		return time.UTC
+	}
+	loc, err := loadLocation(tz)
+	if err != nil {
+		slog.Warn("Ignoring the profile timezone", "user", keys[0], "err", err)
+		return time.UTC
+	}
+	return loc
+}
+
+// bounds returns the -since and -until dates in loc; until is exclusive. They
+// are zero when not specified.
+func (o *statsOptions) bounds(loc *time.Location) (since, until time.Time, err error) {
+	if len(o.since) != 0 {
+		if since, err = parseDate(o.since, loc); err != nil {
+			return since, until, fmt.Errorf("-since: %w", err)
+		}
+	}
+	if len(o.until) != 0 {
+		if until, err = parseDate(o.until, loc); err != nil {
+			return since, until, fmt.Errorf("-until: %w", err)
+		}
+		if len(o.until) == len("2006-01-02") {
+			// Include the whole day.
+			until = until.AddDate(0, 0, 1)
+		}
+	}
+	return since, until, nil
+}
+
+// parseDate parses a date in loc, optionally with the time.
+func parseDate(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, fmt.Errorf("invalid date %q; use YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+// tweets returns the tweets cached under keys within -since and -until, in
+// loc.
+func (o *statsOptions) tweets(c *cache, keys []string, loc *time.Location) []Tweet {
+	// The dates were validated by parse.
+	since, until, _ := o.bounds(loc)
+	var all []Tweet
+	for _, k := range keys {
+		for _, t := range c.get(k) {
+			if o.placeRe != nil && !o.placeRe.MatchString(t.Place) {
+				continue
+			}
+			if (since.IsZero() || !t.CreatedAt.Before(since)) && (until.IsZero() || t.CreatedAt.Before(until)) {
+				t.CreatedAt = t.CreatedAt.In(loc)
+				all = append(all, t)
+			}
+		}
+	}
+	return all
+}
+
+// stats are the statistics of the tweets of a section of the report.
+type stats struct {
+	// Name is the user of the section when there are several.
+	Name string `json:",omitempty"`
+	// Mentions is set when the tweets are the ones mentioning the user.
+	Mentions bool `json:",omitempty"`
+	Timezone string
+	Tweets   int
+	// From and To are the times of the oldest and most recent tweets.
+	From *time.Time `json:",omitempty"`
+	To   *time.Time `json:",omitempty"`
+	// Hours and Weekdays are the number of tweets per hour and per weekday,
+	// starting on Sunday.
+	Hours    [24]int
+	Weekdays [7]int
+	// Punchcard is the number of tweets per weekday and hour.
+	Punchcard [7][24]int
+	// Places is the number of tweets per place.
+	Places map[string]int `json:",omitempty"`
+	// Months and Years are the number of tweets per month, as YYYY-MM, and
+	// per year.
+	Months map[string]int `json:",omitempty"`
+	Years  map[string]int `json:",omitempty"`
+	// Cadence is how regularly the tweets are posted.
+	Cadence *cadence `json:",omitempty"`
+	// Gaps are the largest periods without tweets, the largest first.
+	Gaps []gap `json:",omitempty"`
+	// Chronotype is inferred from Hours.
+	Chronotype *chronotype `json:",omitempty"`
+	// Clients is the number of tweets per client used to post, when known,
+	// and ClientHours per client and hour.
+	Clients     map[string]int     `json:",omitempty"`
+	ClientHours map[string][24]int `json:",omitempty"`
+	// Hashtags are the most used hashtags and MonthHashtags the most used each
+	// month, as YYYY-MM.
+	Hashtags      []hashtag             `json:",omitempty"`
+	MonthHashtags map[string][]tagCount `json:",omitempty"`
+	// Partners are the accounts the most mentioned or replied to.
+	Partners []partner `json:",omitempty"`
+	// Kinds is the number of tweets per kind, "unknown" for the tweets cached
+	// without, and KindHours per kind and hour.
+	Kinds     map[string]int     `json:",omitempty"`
+	KindHours map[string][24]int `json:",omitempty"`
+	// Lengths is the distribution of the length of the original tweets and of
+	// the replies, when their text is stored.
+	Lengths map[string]*lengthStats `json:",omitempty"`
+}
+
+// report prints the stats of the targets cached under keys to stdout, or
+// writes them in -out.
+func (o *statsOptions) report(c *cache, t *targets, keys []string) error {
+	l := o.sections(c, t, keys)
+	if o.template != nil {
+		return o.template.Execute(os.Stdout, l)
+	}
+	if w := fileOutputs[o.output]; w != nil {
+		if err := os.MkdirAll(o.out, 0755); err != nil {
+			return err
+		}
+		files, err := w(o.out, l)
+		for _, p := range files {
+			fmt.Printf("Wrote %s\n", p)
+		}
+		return err
+	}
+	return outputs[o.output](os.Stdout, l)
+}
+
+// sections returns the stats of the targets cached under keys. With several
+// -u, each user gets its own section; the users of -list and -users-file are
+// reported together.
+func (o *statsOptions) sections(c *cache, t *targets, keys []string) []*stats {
+	var l []*stats
+	if len(t.users) < 2 {
+		l = append(l, o.compute(c, keys, t.source))
+	} else {
+		for i, u := range t.users {
+			s := o.compute(c, keys[i:i+1], t.source)
+			s.Name = u
+			l = append(l, s)
+		}
+		if o.combined {
+			s := o.compute(c, keys, t.source)
+			s.Name = "combined"
+			l = append(l, s)
+		}
+	}
+	return l
+}
+
+// compute returns the stats of the tweets cached under keys, fetched from
+// source if known.
+func (o *statsOptions) compute(c *cache, keys []string, source string) *stats {
+	loc := o.location(c, keys)
+	s := &stats{
+		Mentions: len(keys) != 0 && strings.HasSuffix(keys[0], "/mentions"),
+		Timezone: loc.String(),
+		Places:   map[string]int{},
+		Months:   map[string]int{},
+		Years:    map[string]int{},
+		Clients:  map[string]int{},
+	}
+	clientHours := map[string]*[24]int{}
+	kindHours := map[string]*[24]int{}
+	hashtags := newHashtagCounter()
+	partners := newPartnerCounter()
+	lengths := newLengthCounter()
+	var times []time.Time
+	for _, t := range o.tweets(c, keys, loc) {
+		t := t
+		times = append(times, t.CreatedAt)
+		s.Tweets++
+		if s.From == nil || t.CreatedAt.Before(*s.From) {
+			s.From = &t.CreatedAt
+		}
+		if s.To == nil || t.CreatedAt.After(*s.To) {
+			s.To = &t.CreatedAt
+		}
+		s.Hours[t.CreatedAt.Hour()]++
+		s.Weekdays[t.CreatedAt.Weekday()]++
+		s.Punchcard[t.CreatedAt.Weekday()][t.CreatedAt.Hour()]++
+		s.Months[t.CreatedAt.Format("2006-01")]++
+		s.Years[t.CreatedAt.Format("2006")]++
+		if len(t.Place) != 0 {
+			s.Places[t.Place]++
+		}
+		hashtags.add(&t)
+		k := t.Kind
+		if len(k) == 0 {
+			k = kindUnknown
+		}
+		if kindHours[k] == nil {
+			kindHours[k] = &[24]int{}
+		}
+		kindHours[k][t.CreatedAt.Hour()]++
+		partners.add(&t)
+		lengths.add(&t)
+		if len(t.Source) != 0 {
+			s.Clients[t.Source]++
+			if clientHours[t.Source] == nil {
+				clientHours[t.Source] = &[24]int{}
+			}
+			clientHours[t.Source][t.CreatedAt.Hour()]++
+		}
+	}
+	if len(kindHours) > 1 || (len(kindHours) == 1 && kindHours[kindUnknown] == nil) {
+		s.Kinds = map[string]int{}
+		s.KindHours = map[string][24]int{}
+		for k, h := range kindHours {
+			s.KindHours[k] = *h
+			for _, n := range h {
+				s.Kinds[k] += n
+			}
+		}
+	}
+	if len(clientHours) != 0 {
+		s.ClientHours = map[string][24]int{}
+		for c, h := range clientHours {
+			s.ClientHours[c] = *h
+		}
+	}
+	s.Hashtags, s.MonthHashtags = hashtags.top(o.hashtags)
+	s.Partners = partners.top(o.partners)
+	s.Lengths = lengths.stats()
+	s.Cadence = computeCadence(times)
+	s.Chronotype = computeChronotype(s.Hours)
+	// The search API of the mentions doesn't have the 3,200 tweets limit.
+	s.Gaps = largestGaps(times, o.gaps, cappedSources[source] && !s.Mentions)
+	if o.placesTop != 0 {
+		if l := s.placesByCount(); len(l) > o.placesTop {
+			for _, p := range l[o.placesTop:] {
+				delete(s.Places, p)
+			}
+		}
+	}
+	return s
+}
@@ -0,0 +1,756 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// Store is a cache backend.
+//
+// Changes may be buffered until Flush is called. A Store is not safe for
+// concurrent use.
+type Store interface {
+	// Users returns the keys with cached tweets, sorted.
+	Users() ([]string, error)
+	// LoadUser returns the tweets cached under key, from the most recent to the
+	// oldest.
+	LoadUser(key string) ([]Tweet, error)
+	// AppendTweets adds tweets under key. The tweets already cached are
+	// replaced.
+	AppendTweets(key string, tweets []Tweet) error
+	// RemoveUser deletes the tweets cached under key.
+	RemoveUser(key string) error
+	// Meta returns the metadata about the keys.
+	Meta() (*cacheMeta, error)
+	// SetMeta replaces the metadata about the keys.
+	SetMeta(m *cacheMeta) error
+	// Flush persists the changes.
+	Flush() error
+}
+
+// cacheMeta is the metadata about the keys, which is small enough to be
+// loaded and saved as a whole.
+type cacheMeta struct {
+	// Fetched is the last time each key was fetched.
+	Fetched map[string]time.Time `json:",omitempty"`
+	// Aliases maps the keys derived from a name that can change, like a twitter
+	// screen name, to the key derived from the immutable user ID.
+	Aliases map[string]string `json:",omitempty"`
+	// Cursors is where to resume the interrupted fetch of each key.
+	Cursors map[string]string `json:",omitempty"`
+	// Timezones is the timezone found in the profile of each key, as accepted
+	// by -tz.
+	Timezones map[string]string `json:",omitempty"`
+}
+
+func newCacheMeta() *cacheMeta {
+	return &cacheMeta{Fetched: map[string]time.Time{}, Aliases: map[string]string{}, Cursors: map[string]string{}, Timezones: map[string]string{}}
+}
+
+// cacheStore is the cache backend selected with -store and cachePath the file
+// selected with -cache.
+var (
+	cacheStore    = "json"
+	cachePath     string
+	lockTimeout   = 10 * time.Second
+	cacheLockFile *os.File
+	// storeText is set with -store-text.
+	storeText bool
+	// storeEngagement is set with -store-engagement.
+	storeEngagement bool
+	// readOnlyCache is set to open the cache without locking, creating,
+	// upgrading or importing into it, e.g. to complete the command line.
+	readOnlyCache bool
+)
+
+// registerStore registers -store and -cache on f.
+func registerStore(f *flag.FlagSet) {
+	f.BoolVar(&encryptCache, "encrypt", false, "encrypt the cache with the passphrase in $RESTROOM_PASSPHRASE or typed in; an encrypted cache stays encrypted")
+	f.BoolVar(&storeText, "store-text", false, "keep the text of the new tweets in the cache; it makes the cache larger")
+	f.BoolVar(&storeEngagement, "store-engagement", false, "keep the like and retweet counts of the tweets in the cache and refresh them for the most recent tweets")
+	f.DurationVar(&lockTimeout, "lock-timeout", lockTimeout, "how long to wait for another restroom process using the cache to finish")
+	f.StringVar(&cachePath, "cache", "", "path of the cache file; defaults to a file named after -store in $XDG_DATA_HOME/restroom or the OS equivalent")
+	f.Func("store", "cache backend: json (restroom.json, default), sqlite (restroom.db), bolt (restroom.bolt) or shards (one file per user in cache/)", func(s string) error {
+		if _, ok := stores[s]; !ok {
+			return errors.New("expected json, sqlite, bolt or shards")
+		}
+		cacheStore = s
+		return nil
+	})
+}
+
+// storeDef describes a Store selectable with -store.
+type storeDef struct {
+	// file is the default file name.
+	file string
+	open func(p string) (Store, error)
+}
+
+var stores = map[string]storeDef{
+	"json":   {"restroom.json", func(p string) (Store, error) { return openJSONStore(jsonPath(p)) }},
+	"sqlite": {"restroom.db", func(p string) (Store, error) { return openSQLiteStore(p) }},
+	"bolt":   {"restroom.bolt", func(p string) (Store, error) { return openBoltStore(p) }},
+	"shards": {"cache", func(p string) (Store, error) { return openShardStore(p) }},
+}
+
+// dataDir returns the directory where the cache is stored by default.
+func dataDir() (string, error) {
+	if d := os.Getenv("XDG_DATA_HOME"); len(d) != 0 {
+		return filepath.Join(d, "restroom"), nil
+	}
+	switch runtime.GOOS {
+	case "darwin", "ios", "windows", "plan9":
+		d, err := os.UserConfigDir()
+		return filepath.Join(d, "restroom"), err
+	default:
+		d, err := os.UserHomeDir()
+		return filepath.Join(d, ".local", "share", "restroom"), err
+	}
+}
+
+// openStore opens the Store selected with -store and -cache.
+//
+// Without -cache, a restroom.json left in the current directory by older
+// versions is imported the first time.
+//
+// The cache is locked until the process exits so concurrent runs do not
+// overwrite each other's changes.
+func openStore() (Store, error) {
+	def := stores[cacheStore]
+	if encryptCache && cacheStore != "json" && cacheStore != "shards" {
+		return nil, errors.New("-encrypt is only supported with -store json or shards")
+	}
+	if readOnlyCache {
+		p := cachePath
+		if len(p) == 0 {
+			d, err := dataDir()
+			if err != nil {
+				return nil, err
+			}
+			p = filepath.Join(d, def.file)
+		}
+		if cacheStore == "json" {
+			p = jsonPath(p)
+		}
+		if _, err := os.Stat(p); err != nil {
+			return nil, err
+		}
+		return def.open(p)
+	}
+	if len(cachePath) != 0 {
+		if err := lockCache(cachePath); err != nil {
+			return nil, err
+		}
+		return def.open(cachePath)
+	}
+	d, err := dataDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(d, 0700); err != nil {
+		return nil, err
+	}
+	p := filepath.Join(d, def.file)
+	if err := lockCache(p); err != nil {
+		return nil, err
+	}
+	_, err = os.Stat(p)
+	isNew := errors.Is(err, os.ErrNotExist)
+	if cacheStore == "json" {
+		_, err = os.Stat(p + ".gz")
+		isNew = isNew && errors.Is(err, os.ErrNotExist)
+	}
+	s, err := def.open(p)
+	if err != nil || !isNew {
+		return s, err
+	}
+	legacy := jsonPath("restroom.json")
+	if abs, _ := filepath.Abs(legacy); filepath.Dir(abs) == d {
+		return s, nil
+	}
+	if err := importJSON(s, legacy); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(legacy); err == nil {
+		fmt.Fprintf(os.Stderr, "restroom: imported %s into %s; it can be deleted\n", legacy, p)
+	}
+	return s, nil
+}
+
+// lockCache takes an advisory lock on the cache file p, held until the
+// process exits.
+func lockCache(p string) error {
+	f, err := os.OpenFile(p+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	for start := time.Now(); ; {
+		ok, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if ok {
+			// Keep a reference so the file is not closed by the finalizer.
+			cacheLockFile = f
+			return nil
+		}
+		if time.Since(start) >= lockTimeout {
+			f.Close()
+			return fmt.Errorf("%s is in use by another restroom process; retry later or increase -lock-timeout", p)
+		}
+		slog.Info("Waiting for the lock", "cache", p)
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// importJSON copies the JSON cache p, if present, into dst.
+func importJSON(dst Store, p string) error {
+	src, err := openJSONStore(jsonPath(p))
+	if err != nil || len(src.users) == 0 {
+		return err
+	}
+	slog.Info("Importing", "cache", src.path)
+	return copyStore(dst, src)
+}
+
+// copyStore copies all the content of src into dst.
+func copyStore(dst, src Store) error {
+	keys, err := src.Users()
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		l, err := src.LoadUser(k)
+		if err != nil {
+			return err
+		}
+		if err := dst.AppendTweets(k, l); err != nil {
+			return err
+		}
+	}
+	m, err := src.Meta()
+	if err != nil {
+		return err
+	}
+	if err := dst.SetMeta(m); err != nil {
+		return err
+	}
+	return dst.Flush()
+}
+
+// memStore is a Store in memory.
+type memStore struct {
+	users map[string][]Tweet
+	meta  *cacheMeta
+}
+
+func newMemStore() *memStore {
+	return &memStore{users: map[string][]Tweet{}, meta: newCacheMeta()}
+}
+
+func (m *memStore) Users() ([]string, error) {
+	out := make([]string, 0, len(m.users))
+	for k := range m.users {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func (m *memStore) LoadUser(key string) ([]Tweet, error) {
+	return m.users[key], nil
+}
+
+func (m *memStore) AppendTweets(key string, tweets []Tweet) error {
+	ids := map[int64]int{}
+	for i, t := range m.users[key] {
+		ids[t.Id] = i
+	}
+	n := 0
+	for _, t := range tweets {
+		if i, ok := ids[t.Id]; ok {
+			m.users[key][i] = t
+			continue
+		}
+		ids[t.Id] = len(m.users[key])
+		m.users[key] = append(m.users[key], t)
+		n++
+	}
+	if n != 0 {
+		sortTweets(m.users[key])
+	}
+	return nil
+}
+
+func (m *memStore) RemoveUser(key string) error {
+	delete(m.users, key)
+	return nil
+}
+
+func (m *memStore) Meta() (*cacheMeta, error) {
+	return m.meta, nil
+}
+
+func (m *memStore) SetMeta(meta *cacheMeta) error {
+	m.meta = meta
+	return nil
+}
+
+func (m *memStore) Flush() error {
+	return nil
+}
+
+// jsonFile is the format of restroom.json.
+type jsonFile struct {
+	Version int
+	// Restroom is the version of restroom that last wrote the file.
+	Restroom string `json:",omitempty"`
+	Users    map[string][]Tweet
+	cacheMeta
+}
+
+// jsonPath returns p.gz if it exists, p otherwise.
+func jsonPath(p string) string {
+	if strings.HasSuffix(p, ".gz") {
+		return p
+	}
+	if _, err := os.Stat(p + ".gz"); err == nil {
+		return p + ".gz"
+	}
+	return p
+}
+
+// jsonStore is a memStore saved as a whole in a JSON file. All the users are
+// loaded in memory; the other Stores load the users queried.
+//
+// The file is compressed if it was already, detected by the gzip magic
+// bytes, or if its name ends with ".gz". It is encrypted if it was already or
+// with -encrypt.
+type jsonStore struct {
+	memStore
+	path    string
+	gzip    bool
+	encrypt bool
+	// plain is set when the file on disk is not encrypted.
+	plain bool
+	// dirty is set when the tweets changed since they were loaded and loaded
+	// is the metadata as loaded, so an unchanged cache isn't rewritten.
+	dirty  bool
+	loaded []byte
+}
+
+func openJSONStore(p string) (*jsonStore, error) {
+	s := &jsonStore{memStore: *newMemStore(), path: p, gzip: strings.HasSuffix(p, ".gz"), encrypt: encryptCache}
+	r, gz, enc, err := openCacheFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	defer r.Close()
+	s.gzip = s.gzip || gz
+	s.encrypt = s.encrypt || enc
+	s.plain = !enc
+	var c jsonFile
+	if err := decodeJSONFile(r, &c); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	s.dirty = c.Version < cacheVersion
+	if err := migrateJSON(&c); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	if c.Users != nil {
+		s.users = c.Users
+	}
+	if c.Fetched != nil {
+		s.meta.Fetched = c.Fetched
+	}
+	if c.Aliases != nil {
+		s.meta.Aliases = c.Aliases
+	}
+	if c.Cursors != nil {
+		s.meta.Cursors = c.Cursors
+	}
+	if c.Timezones != nil {
+		s.meta.Timezones = c.Timezones
+	}
+	if s.loaded, err = json.Marshal(s.meta); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *jsonStore) AppendTweets(key string, tweets []Tweet) error {
+	if len(tweets) != 0 {
+		s.dirty = true
+	}
+	return s.memStore.AppendTweets(key, tweets)
+}
+
+func (s *jsonStore) RemoveUser(key string) error {
+	if _, ok := s.users[key]; ok {
+		s.dirty = true
+	}
+	return s.memStore.RemoveUser(key)
+}
+
+// Flush writes the file, unless nothing changed so the backup of the previous
+// write is kept.
+func (s *jsonStore) Flush() error {
+	m, err := json.Marshal(s.meta)
+	if err != nil {
+		return err
+	}
+	if !s.dirty && !(s.encrypt && s.plain) && bytes.Equal(m, s.loaded) {
+		return nil
+	}
+	c := &jsonFile{Version: cacheVersion, Restroom: version(), Users: s.users, cacheMeta: *s.meta}
+	write := func(w io.Writer) error {
+		cw := newCacheWriter(w, s.gzip, s.encrypt)
+		if err := encodeJSONFile(cw, c); err != nil {
+			return err
+		}
+		return cw.Close()
+	}
+	if s.encrypt && s.plain {
+		// Do not leave an unencrypted backup behind.
+		if err := writeFileAtomicFunc(s.path, 0600, false, write); err != nil {
+			return err
+		}
+		s.plain = false
+		if err := os.Remove(s.path + ".bak"); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	} else if err := writeFileAtomicFunc(s.path, 0600, true, write); err != nil {
+		return err
+	}
+	s.dirty = false
+	s.loaded = m
+	return nil
+}
+
+// Compact implements compacter by deleting the backup, which still has the
+// tweets removed.
+func (s *jsonStore) Compact() error {
+	if err := os.Remove(s.path + ".bak"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// decodeJSONFile decodes restroom.json one user at a time, so large caches
+// are not held twice in memory. An empty file is an empty cache.
+//
+// The tweets of an older version are upgraded as they are decoded, which
+// relies on Version being written before Users.
+func decodeJSONFile(r io.Reader, c *jsonFile) error {
+	d := json.NewDecoder(r)
+	t, err := d.Token()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if t != json.Delim('{') {
+		return errors.New("expected a JSON object")
+	}
+	for d.More() {
+		if t, err = d.Token(); err != nil {
+			return err
+		}
+		switch t {
+		case "Version":
+			err = d.Decode(&c.Version)
+		case "Restroom":
+			err = d.Decode(&c.Restroom)
+		case "Users":
+			err = decodeUsers(d, c)
+		case "Fetched":
+			err = d.Decode(&c.Fetched)
+		case "Aliases":
+			err = d.Decode(&c.Aliases)
+		case "Cursors":
+			err = d.Decode(&c.Cursors)
+		case "Timezones":
+			err = d.Decode(&c.Timezones)
+		default:
+			var skip json.RawMessage
+			err = d.Decode(&skip)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err = d.Token()
+	return err
+}
+
+// decodeUsers decodes the "Users" object of restroom.json.
+func decodeUsers(d *json.Decoder, c *jsonFile) error {
+	t, err := d.Token()
+	if err != nil || t == nil {
+		return err
+	}
+	if t != json.Delim('{') {
+		return errors.New("expected Users to be an object")
+	}
+	c.Users = map[string][]Tweet{}
+	for d.More() {
+		if t, err = d.Token(); err != nil {
+			return err
+		}
+		l, err := decodeTweets(d, c.Version)
+		if err != nil {
+			return fmt.Errorf("%s: %w", t, err)
+		}
+		c.Users[t.(string)] = l
+	}
+	_, err = d.Token()
+	return err
+}
+
+// encodeJSONFile writes c one user at a time in the same format as
+// json.Marshal. The write errors are expected to be sticky, like with
+// bufio.Writer, and returned when the writer is closed.
+func encodeJSONFile(w io.Writer, c *jsonFile) error {
+	fmt.Fprintf(w, `{"Version":%d,`, c.Version)
+	if len(c.Restroom) != 0 {
+		b, err := json.Marshal(c.Restroom)
+		if err != nil {
+			return err
+		}
+		io.WriteString(w, `"Restroom":`)
+		w.Write(b)
+		io.WriteString(w, ",")
+	}
+	io.WriteString(w, `"Users":{`)
+	keys := make([]string, 0, len(c.Users))
+	for k := range c.Users {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		kb, err := json.Marshal(k)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(c.Users[k])
+		if err != nil {
+			return err
+		}
+		if i != 0 {
+			io.WriteString(w, ",")
+		}
+		w.Write(kb)
+		io.WriteString(w, ":")
+		w.Write(b)
+	}
+	io.WriteString(w, "}")
+	for _, f := range []struct {
+		name string
+		v    interface{}
+		n    int
+	}{{"Fetched", c.Fetched, len(c.Fetched)}, {"Aliases", c.Aliases, len(c.Aliases)}, {"Cursors", c.Cursors, len(c.Cursors)}, {"Timezones", c.Timezones, len(c.Timezones)}} {
+		if f.n == 0 {
+			continue
+		}
+		b, err := json.Marshal(f.v)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, `,"%s":`, f.name)
+		w.Write(b)
+	}
+	_, err := io.WriteString(w, "}")
+	return err
+}
+
+// cacheReader is a decoded cache file.
+type cacheReader struct {
+	io.Reader
+	io.Closer
+}
+
+// openCacheFile opens p for reading, decrypting and decompressing as needed,
+// and returns whether it was compressed and encrypted. Only encrypted files
+// are read in memory as a whole.
+func openCacheFile(p string) (io.ReadCloser, bool, bool, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, false, false, err
+	}
+	r := bufio.NewReader(f)
+	m, _ := r.Peek(len(encMagic))
+	enc := isEncrypted(m)
+	if enc {
+		b, err := ioutil.ReadAll(r)
+		if err == nil {
+			b, err = decrypt(b)
+		}
+		if err != nil {
+			f.Close()
+			return nil, false, false, err
+		}
+		r = bufio.NewReader(bytes.NewReader(b))
+	}
+	m, _ = r.Peek(2)
+	gz := len(m) == 2 && m[0] == 0x1f && m[1] == 0x8b
+	if gz {
+		z, err := gzip.NewReader(r)
+		if err != nil {
+			f.Close()
+			return nil, false, false, err
+		}
+		return cacheReader{z, f}, gz, enc, nil
+	}
+	return cacheReader{r, f}, gz, enc, nil
+}
+
+// readCacheFile returns the content of p, decrypted and decompressed as
+// needed, and whether it was compressed and encrypted.
+func readCacheFile(p string) ([]byte, bool, bool, error) {
+	r, gz, enc, err := openCacheFile(p)
+	if err != nil {
+		return nil, false, false, err
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	return b, gz, enc, err
+}
+
+// cacheWriter compresses then encrypts what is written to it. Encrypted
+// content is buffered in memory until Close.
+type cacheWriter struct {
+	w   io.Writer
+	bw  *bufio.Writer
+	z   *gzip.Writer
+	buf *bytes.Buffer
+}
+
+func newCacheWriter(w io.Writer, gz, enc bool) *cacheWriter {
+	c := &cacheWriter{w: w}
+	out := w
+	if enc {
+		c.buf = &bytes.Buffer{}
+		out = c.buf
+	}
+	if gz {
+		c.z = gzip.NewWriter(out)
+		out = c.z
+	}
+	c.bw = bufio.NewWriterSize(out, 1<<16)
+	return c
+}
+
+func (c *cacheWriter) Write(b []byte) (int, error) {
+	return c.bw.Write(b)
+}
+
+// Close flushes the content to the underlying writer.
+func (c *cacheWriter) Close() error {
+	if err := c.bw.Flush(); err != nil {
+		return err
+	}
+	if c.z != nil {
+		if err := c.z.Close(); err != nil {
+			return err
+		}
+	}
+	if c.buf != nil {
+		b, err := encrypt(c.buf.Bytes())
+		if err != nil {
+			return err
+		}
+		_, err = c.w.Write(b)
+		return err
+	}
+	return nil
+}
+
+// encodeCacheFile compresses then encrypts b as requested.
+func encodeCacheFile(b []byte, gz, enc bool) ([]byte, error) {
+	var buf bytes.Buffer
+	w := newCacheWriter(&buf, gz, enc)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeFileAtomic replaces p with b so that a crash leaves either the old or
+// the new content, with the permissions perm. If backup is true, the previous
+// content is kept as p.bak.
+func writeFileAtomic(p string, b []byte, perm os.FileMode, backup bool) error {
+	return writeFileAtomicFunc(p, perm, backup, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+}
+
+// writeFileAtomicFunc is writeFileAtomic with the content written by write.
+func writeFileAtomicFunc(p string, perm os.FileMode, backup bool, write func(w io.Writer) error) error {
+	f, err := ioutil.TempFile(filepath.Dir(p), filepath.Base(p)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	err = write(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if backup {
+		bak := p + ".bak"
+		os.Remove(bak)
+		if err := os.Link(p, bak); err != nil && !errors.Is(err, os.ErrNotExist) {
+			// Hard links are not supported everywhere; a copy is good enough.
+			if old, err := ioutil.ReadFile(p); err == nil {
+				ioutil.WriteFile(bak, old, 0600)
+			}
+		}
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// Persist the rename itself. This is not supported on Windows.
+	if d, err := os.Open(filepath.Dir(p)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
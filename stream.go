@@ -0,0 +1,132 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ChimeraCoder/anaconda"
+	"golang.org/x/exp/slog"
+)
+
+// streamTweets subscribes to a filtered stream and appends the matching tweets
+// to the cache as they arrive, until interrupted.
+func streamTweets(args []string) error {
+	f := flag.NewFlagSet("stream", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "usage: restroom stream -t <token> -s <tokensecret> [-u <user> | -q <query>]\n")
+		f.PrintDefaults()
+	}
+	user := f.String("u", "", "user whose new tweets are collected")
+	query := f.String("q", "", "track query whose matching tweets are collected")
+	flush := f.Duration("flush", time.Minute, "interval at which the cache is saved")
+	registerStore(f)
+	logs := registerLog(f)
+	cred := registerCredentials(f)
+	proxy := registerProxy(f)
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+
+	if err := logs.apply(); err != nil {
+		return err
+	}
+	if f.NArg() != 0 {
+		return errors.New("unexpected argument")
+	}
+	if err := setProxy(*proxy); err != nil {
+		return err
+	}
+	if (len(*user) == 0) == (len(*query) == 0) {
+		return errors.New("one of -u or -q is required")
+	}
+	if err := cred.loadDefaults(); err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if cred.appOnly() {
+		// Streams need a user context.
+		cred.Bearer = ""
+	}
+	api, err := twitterAPI(ctx, cred)
+	if err == errNoCredentials {
+		return errors.New("-t and -s are required")
+	}
+	if err != nil {
+		return err
+	}
+	defer api.Close()
+
+	// https://developer.twitter.com/en/docs/twitter-api/v1/tweets/filter-realtime/api-reference/post-statuses-filter
+	c := load()
+	defer c.save()
+	var key string
+	var userID int64
+	v := url.Values{}
+	if len(*user) != 0 {
+		u, err := api.GetUsersShow(*user, nil)
+		if err != nil {
+			return err
+		}
+		// Same key as the twitter source.
+		key = "id:" + u.IdStr
+		c.alias(*user, key)
+		userID = u.Id
+		v.Set("follow", u.IdStr)
+	} else {
+		// Same bucket as -q when fetching.
+		key = "q:" + *query
+		v.Set("track", *query)
+	}
+
+	stream := api.PublicStreamFilter(v)
+	defer stream.Stop()
+	tick := time.NewTicker(*flush)
+	defer tick.Stop()
+	var pending []Tweet
+	total := 0
+	save := func() {
+		n := c.merge(key, pending)
+		total += n
+		pending = pending[:0]
+		c.save()
+		slog.Info("Saved new tweets", "count", n)
+	}
+	fmt.Fprintf(os.Stderr, "Streaming into %s; press Ctrl-C to stop\n", key)
+	for {
+		select {
+		case item := <-stream.C:
+			tweet, ok := item.(anaconda.Tweet)
+			if !ok {
+				slog.Debug("Ignoring stream item", "type", fmt.Sprintf("%T", item))
+				continue
+			}
+			// follow also returns the replies to and retweets of the user's tweets.
+			if userID != 0 && tweet.User.Id != userID {
+				continue
+			}
+			t, err := tweet.CreatedAtTime()
+			if err != nil {
+				return err
+			}
+			pending = append(pending, Tweet{CreatedAt: t, Id: tweet.Id, Place: tweet.Place.Name, Text: tweet.FullText, Source: clientName(tweet.Source), Geo: tweetGeo(tweet.Coordinates, tweet.Place.BoundingBox.Coordinates), Kind: tweetKind(tweet.InReplyToStatusID != 0, tweet.RetweetedStatus != nil, tweet.QuotedStatusID != 0)})
+			setV1Entities(&pending[len(pending)-1], &tweet.Entities, &tweet.ExtendedEntities)
+		case <-tick.C:
+			save()
+		case <-ctx.Done():
+			save()
+			fmt.Printf("Collected %d new tweets\n", total)
+			return nil
+		}
+	}
+}
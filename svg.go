@@ -0,0 +1,149 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	fileOutputs["svg"] = writeSVG
+}
+
+// chart is a histogram to render as an image.
+type chart struct {
+	// name is the suffix of the file name.
+	name   string
+	title  string
+	labels []string
+	values []int
+}
+
+// charts returns the histograms of s to render.
+func (s *stats) charts() []chart {
+	hourTitle, weekdayTitle := s.titles()
+	hours := chart{name: "hours", title: hourTitle + " in " + s.Timezone, values: s.Hours[:]}
+	for i := range s.Hours {
+		hours.labels = append(hours.labels, hourTick(i))
+	}
+	weekdays := chart{name: "weekdays", title: weekdayTitle + " in " + s.Timezone}
+	for _, d := range cal.order() {
+		weekdays.labels = append(weekdays.labels, cal.abbr[d])
+		weekdays.values = append(weekdays.values, s.Weekdays[d])
+	}
+	years := chart{name: "years", title: s.trendTitle("year")}
+	for _, y := range s.years() {
+		years.labels = append(years.labels, y)
+		years.values = append(years.values, s.Years[y])
+	}
+	if len(years.values) == 0 {
+		// A section without tweets has no year to plot.
+		return []chart{hours, weekdays}
+	}
+	return []chart{hours, weekdays, years}
+}
+
+// chartPath returns the path of the file for the chart c of s.
+func chartPath(dir string, s *stats, c chart, ext string) string {
+	n := c.name + ext
+	if len(s.Name) != 0 {
+		n = strings.TrimSuffix(shardName(s.Name), ".json") + "-" + n
+	}
+	return filepath.Join(dir, n)
+}
+
+// writeSVG writes the histograms of each section as SVG files.
+func writeSVG(dir string, l []*stats) ([]string, error) {
+	var out []string
+	for _, s := range l {
+		for _, c := range s.charts() {
+			p := chartPath(dir, s, c, ".svg")
+			if err := writeFileAtomic(p, c.svg(), 0644, false); err != nil {
+				return out, err
+			}
+			out = append(out, p)
+		}
+		p := chartPath(dir, s, chart{name: "punchcard"}, ".svg")
+		if err := writeFileAtomic(p, s.punchcardSVG(), 0644, false); err != nil {
+			return out, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// xmlEscape escapes s for use in a SVG file.
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// svg renders c as a bar chart. It doesn't reference anything external so it
+// can be embedded anywhere.
+func (c *chart) svg() []byte {
+	const barWidth, gap, height, top, left = 24, 6, 200, 30, 40
+	max := 1
+	for _, v := range c.values {
+		if v > max {
+			max = v
+		}
+	}
+	width := left + len(c.values)*(barWidth+gap) + gap
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n", width, top+height+30, width, top+height+30)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+	fmt.Fprintf(&b, `<text x="%d" y="18" font-size="14">%s</text>`+"\n", left, xmlEscape(c.title))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end" fill="#555">%d</text>`+"\n", left-6, top+10, max)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end" fill="#555">0</text>`+"\n", left-6, top+height)
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#999"/>`+"\n", left, top+height, width, top+height)
+	for i, v := range c.values {
+		h := height * v / max
+		x := left + gap + i*(barWidth+gap)
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="#4a7ebb"><title>%s: %d</title></rect>`+"\n", x, top+height-h, barWidth, h, xmlEscape(c.labels[i]), v)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" fill="#555">%s</text>`+"\n", x+barWidth/2, top+height+15, xmlEscape(c.labels[i]))
+	}
+	b.WriteString("</svg>\n")
+	return b.Bytes()
+}
+
+// punchcardSVG renders the tweets per weekday and hour of s as a grid of
+// circles whose area is proportional to the number of tweets.
+func (s *stats) punchcardSVG() []byte {
+	const cell, top, left = 28, 30, 40
+	max := 1
+	for _, r := range s.Punchcard {
+		if m := maxOf(r[:]); m > max {
+			max = m
+		}
+	}
+	width := left + 24*cell
+	height := top + 7*cell + 20
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n", width, height, width, height)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+	fmt.Fprintf(&b, `<text x="%d" y="18" font-size="14">%s</text>`+"\n", left, xmlEscape(s.punchcardTitle()+" in "+s.Timezone))
+	for i, d := range cal.order() {
+		y := top + i*cell + cell/2
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end" fill="#555">%s</text>`+"\n", left-6, y+4, xmlEscape(cal.abbr[d]))
+		for h, n := range s.Punchcard[d] {
+			if n == 0 {
+				continue
+			}
+			radius := float64(cell/2-1) * math.Sqrt(float64(n)/float64(max))
+			fmt.Fprintf(&b, `<circle cx="%d" cy="%d" r="%.1f" fill="#4a7ebb"><title>%s %s: %d</title></circle>`+"\n", left+h*cell+cell/2, y, radius, xmlEscape(cal.days[d]), hourLabel(h), n)
+		}
+	}
+	for h := 0; h < 24; h++ {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" fill="#555">%s</text>`+"\n", left+h*cell+cell/2, top+7*cell+15, hourTick(h))
+	}
+	b.WriteString("</svg>\n")
+	return b.Bytes()
+}
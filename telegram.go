@@ -0,0 +1,153 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+func init() {
+	importers["telegram"] = importTelegram
+}
+
+type telegramMessage struct {
+	ID           int64  `json:"id"`
+	Type         string `json:"type"`
+	Date         string `json:"date"`
+	DateUnixtime string `json:"date_unixtime"`
+	From         string `json:"from"`
+	FromID       string `json:"from_id"`
+}
+
+// importTelegram parses the result.json of a Telegram Desktop export, either
+// of a single chat or of the whole account.
+//
+// Exports can be hundreds of MB so the file is walked token by token and
+// only one message is decoded at a time. The chat name is stored as the place.
+func importTelegram(p string, o *importOptions) ([]Tweet, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	w := telegramWalker{dec: json.NewDecoder(bufio.NewReader(f)), o: o}
+	if err := w.value(); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	return w.out, nil
+}
+
+type telegramWalker struct {
+	dec *json.Decoder
+	o   *importOptions
+	out []Tweet
+}
+
+// value walks the next value.
+func (w *telegramWalker) value() error {
+	t, err := w.dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := t.(json.Delim); ok {
+		if d == '{' {
+			return w.object()
+		}
+		return w.array()
+	}
+	return nil
+}
+
+// array walks an array whose opening delimiter was already read.
+func (w *telegramWalker) array() error {
+	for w.dec.More() {
+		if err := w.value(); err != nil {
+			return err
+		}
+	}
+	_, err := w.dec.Token()
+	return err
+}
+
+// object walks an object whose opening delimiter was already read. A chat is
+// an object with "name", "id" and "messages", in that order.
+func (w *telegramWalker) object() error {
+	chat := ""
+	var chatID int64
+	for w.dec.More() {
+		k, err := w.dec.Token()
+		if err != nil {
+			return err
+		}
+		if k == "messages" {
+			if err := w.messages(chat, chatID); err != nil {
+				return err
+			}
+			continue
+		}
+		t, err := w.dec.Token()
+		if err != nil {
+			return err
+		}
+		switch v := t.(type) {
+		case json.Delim:
+			if v == '{' {
+				err = w.object()
+			} else {
+				err = w.array()
+			}
+			if err != nil {
+				return err
+			}
+		case string:
+			if k == "name" {
+				chat = v
+			}
+		case float64:
+			if k == "id" {
+				chatID = int64(v)
+			}
+		}
+	}
+	_, err := w.dec.Token()
+	return err
+}
+
+func (w *telegramWalker) messages(chat string, chatID int64) error {
+	if t, err := w.dec.Token(); err != nil {
+		return err
+	} else if t != json.Delim('[') {
+		return fmt.Errorf("expected messages array, got %v", t)
+	}
+	for w.dec.More() {
+		var m telegramMessage
+		if err := w.dec.Decode(&m); err != nil {
+			return err
+		}
+		if m.Type != "message" {
+			continue
+		}
+		if len(w.o.from) != 0 && m.From != w.o.from && m.FromID != w.o.from {
+			continue
+		}
+		var t time.Time
+		if s, err := strconv.ParseInt(m.DateUnixtime, 10, 64); err == nil {
+			t = time.Unix(s, 0).UTC()
+		} else if t, err = time.ParseInLocation("2006-01-02T15:04:05", m.Date, time.Local); err != nil {
+			// Older exports only have the date in the exporting computer's local
+			// time.
+			return fmt.Errorf("message %d: %w", m.ID, err)
+		}
+		// Message IDs are only unique per chat.
+		w.out = append(w.out, Tweet{CreatedAt: t, Id: hashID(strconv.FormatInt(chatID, 10) + "/" + strconv.FormatInt(m.ID, 10)), Place: chat})
+	}
+	_, err := w.dec.Token()
+	return err
+}
@@ -0,0 +1,71 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateFuncs are the functions available to the -template files, in
+// addition to the text/template builtins.
+var templateFuncs = template.FuncMap{
+	// weekday returns the name of a weekday, 0 being Sunday, as selected with
+	// -lang, and weekdays the weekdays in the order selected with -week-start.
+	"weekday": func(d int) string { return cal.days[time.Weekday(d)%7] },
+	"weekdays": func() []int {
+		var out []int
+		for _, d := range cal.order() {
+			out = append(out, int(d))
+		}
+		return out
+	},
+	// hour returns the label of an hour as selected with -clock.
+	"hour": hourLabel,
+	// places returns the places of a section in the order selected with
+	// -places-sort.
+	"places": func(s *stats) []string { return s.places() },
+	// kinds returns the kinds of tweets of a section, from .Kinds.
+	"kinds": func(s *stats) []string { return s.kinds() },
+	// clients returns the clients of a section, the most used first.
+	"clients": func(s *stats) []string { return s.clients() },
+	// months and years return the periods from the first tweet of a section
+	// to the last one, the keys of .Months and .Years.
+	"months": func(s *stats) []string { return s.months() },
+	"years":  func(s *stats) []string { return s.years() },
+	// peaks returns the busiest hours of the week of a section, from
+	// .Punchcard.
+	"peaks":   func(s *stats, n int) []slot { return s.peaks(n) },
+	"percent": percent,
+	// interval formats .Cadence.MedianInterval for humans.
+	"interval": func(seconds float64) string { return formatInterval(time.Duration(seconds * float64(time.Second))) },
+	// sparkline and max accept the histograms like .Hours and .Weekdays.
+	"sparkline": func(l interface{}) string { return sparkline(ints(l)) },
+	"max":       func(l interface{}) int { return maxOf(ints(l)) },
+	"bar":       bar,
+	"join":      strings.Join,
+	"version":   version,
+}
+
+// loadTemplate parses the template file at path.
+func loadTemplate(path string) (*template.Template, error) {
+	return template.New(filepath.Base(path)).Funcs(templateFuncs).ParseFiles(path)
+}
+
+// ints returns the array or slice of ints l as a slice.
+func ints(l interface{}) []int {
+	v := reflect.ValueOf(l)
+	if k := v.Kind(); k != reflect.Array && k != reflect.Slice {
+		return nil
+	}
+	out := make([]int, v.Len())
+	for i := range out {
+		out[i] = int(v.Index(i).Int())
+	}
+	return out
+}
@@ -0,0 +1,223 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// tuiCmd explores the stats of the users in the cache interactively.
+func tuiCmd(args []string) error {
+	f := flag.NewFlagSet("tui", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "usage: restroom tui [-since <date>] [-until <date>] [-tz <timezone>]\n")
+		f.PrintDefaults()
+	}
+	o := registerStats(f, false)
+	registerStore(f)
+	logs := registerLog(f)
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+
+	if err := logs.apply(); err != nil {
+		return err
+	}
+	if f.NArg() != 0 {
+		return errors.New("unexpected argument")
+	}
+	if err := o.parse(); err != nil {
+		return err
+	}
+	goOffline()
+	c := load()
+	defer c.save()
+	all, err := c.store.Users()
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for _, k := range all {
+		if len(c.get(k)) != 0 {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return errors.New("the cache is empty; run restroom fetch first")
+	}
+	return newTUI(c, o, keys).app.Run()
+}
+
+// tui is the state of the interactive mode.
+type tui struct {
+	c    *cache
+	o    *statsOptions
+	keys []string
+
+	app   *tview.Application
+	users *tview.List
+	since *tview.InputField
+	until *tview.InputField
+	tz    *tview.InputField
+	chart *chartView
+	// cur is the section shown, to move the dates from.
+	cur *stats
+}
+
+// chartView renders the stats again when its width changes.
+type chartView struct {
+	*tview.TextView
+	render func(width int) string
+	width  int
+}
+
+func (v *chartView) Draw(screen tcell.Screen) {
+	if _, _, w, _ := v.GetInnerRect(); w != v.width {
+		v.width = w
+		v.SetText(v.render(w))
+		v.ScrollToBeginning()
+	}
+	v.TextView.Draw(screen)
+}
+
+// newTUI lays out a list of the users on the left and the stats of the one
+// selected on the right, below the fields to filter them.
+func newTUI(c *cache, o *statsOptions, keys []string) *tui {
+	t := &tui{c: c, o: o, keys: keys, app: tview.NewApplication()}
+	t.users = tview.NewList().ShowSecondaryText(false)
+	t.users.SetBorder(true).SetTitle(" Users ")
+	t.users.AddItem("All users", "", 0, nil)
+	names := c.displayNames()
+	for _, k := range keys {
+		n := k
+		if a, ok := names[k]; ok {
+			n = a
+		}
+		t.users.AddItem(tview.Escape(n), "", 0, nil)
+	}
+	t.users.SetChangedFunc(func(int, string, string, rune) { t.refresh() })
+
+	t.since = t.dateField("Since ", o.since, -1)
+	t.until = t.dateField("Until ", o.until, 1)
+	t.tz = tview.NewInputField().SetLabel("Timezone ").SetText(o.tz).SetPlaceholder("profile or UTC")
+	t.tz.SetChangedFunc(func(string) { t.refresh() })
+	fields := tview.NewFlex().
+		AddItem(t.since, 0, 1, false).
+		AddItem(t.until, 0, 1, false).
+		AddItem(t.tz, 0, 1, false)
+
+	t.chart = &chartView{TextView: tview.NewTextView(), render: t.render, width: -1}
+	t.chart.SetBorder(true)
+
+	help := tview.NewTextView().SetText("Tab: next panel  ↑/↓ in a date: one month later/earlier  Esc: quit")
+	right := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(fields, 1, 0, false).
+		AddItem(t.chart, 0, 1, false)
+	body := tview.NewFlex().
+		AddItem(t.users, 30, 0, true).
+		AddItem(right, 0, 1, false)
+	root := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(body, 0, 1, true).
+		AddItem(help, 1, 0, false)
+
+	focus := []tview.Primitive{t.users, t.since, t.until, t.tz, t.chart}
+	t.app.SetInputCapture(func(e *tcell.EventKey) *tcell.EventKey {
+		switch e.Key() {
+		case tcell.KeyEscape:
+			t.app.Stop()
+			return nil
+		case tcell.KeyTab, tcell.KeyBacktab:
+			d := 1
+			if e.Key() == tcell.KeyBacktab {
+				d = len(focus) - 1
+			}
+			for i, p := range focus {
+				if p.HasFocus() {
+					t.app.SetFocus(focus[(i+d)%len(focus)])
+					break
+				}
+			}
+			return nil
+		}
+		return e
+	})
+	t.app.SetRoot(root, true)
+	return t
+}
+
+// dateField returns an input field for -since or -until; the up and down keys
+// move the date by a month. When empty, it starts from the oldest tweet if
+// edge is negative, the most recent one otherwise.
+func (t *tui) dateField(label, value string, edge int) *tview.InputField {
+	i := tview.NewInputField().SetLabel(label).SetText(value).SetPlaceholder("YYYY-MM-DD")
+	i.SetChangedFunc(func(string) { t.refresh() })
+	i.SetInputCapture(func(e *tcell.EventKey) *tcell.EventKey {
+		months := 0
+		switch e.Key() {
+		case tcell.KeyUp:
+			months = 1
+		case tcell.KeyDown:
+			months = -1
+		default:
+			return e
+		}
+		d, err := time.Parse("2006-01-02", i.GetText())
+		if len(i.GetText()) == 0 && t.cur != nil && t.cur.From != nil {
+			d, err = *t.cur.From, nil
+			if edge > 0 {
+				d = *t.cur.To
+			}
+		}
+		if err == nil {
+			i.SetText(d.AddDate(0, months, 0).Format("2006-01-02"))
+		}
+		return nil
+	})
+	return i
+}
+
+// selected returns the name and the cache keys of the selected list item.
+func (t *tui) selected() (string, []string) {
+	i := t.users.GetCurrentItem()
+	if i == 0 {
+		return "All users", t.keys
+	}
+	n, _ := t.users.GetItemText(i)
+	return n, t.keys[i-1 : i]
+}
+
+// refresh renders the chart again with the current selection and fields.
+func (t *tui) refresh() {
+	if t.chart != nil {
+		t.chart.width = -1
+	}
+}
+
+// render returns the stats of the selection fitting in width columns.
+func (t *tui) render(width int) string {
+	name, keys := t.selected()
+	t.chart.SetTitle(" " + name + " ")
+	t.o.since = t.since.GetText()
+	t.o.until = t.until.GetText()
+	t.o.tz = t.tz.GetText()
+	t.o.loc = nil
+	if err := t.o.parse(); err != nil {
+		t.cur = nil
+		return err.Error()
+	}
+	// The source of the keys isn't known, so the gaps are not blamed on the
+	// limit of the Twitter API.
+	t.cur = t.o.compute(t.c, keys, "")
+	var b bytes.Buffer
+	writeText(&b, []*stats{t.cur}, width, false)
+	return b.String()
+}
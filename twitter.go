@@ -0,0 +1,544 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChimeraCoder/anaconda"
+	"github.com/garyburd/go-oauth/oauth"
+	"golang.org/x/exp/slog"
+)
+
+func init() {
+	registerSource("twitter", sourceDef{
+		flags: func(f *flag.FlagSet) {
+			f.StringVar(&twitterTimeline, "timeline", "posts", "twitter timeline to fetch: posts, likes or mentions")
+		},
+		new: func(cred *credentials) Source {
+			// Keep the limits across users, and across runs for each profile.
+			store := openLimiterStore()
+			prefix := "twitter/" + keyringAccount(cred.Profile) + "/"
+			posts, search, lookup := 300, 180, 900
+			if cred.appOnly() {
+				// App-only authentication has a separate and more generous pool.
+				prefix += "app/"
+				posts, search, lookup = 1500, 450, 300
+			}
+			limits := map[string]*windowLimiter{
+				"posts":  store.limiter(prefix+"posts", posts, 15*time.Minute),
+				"likes":  store.limiter(prefix+"likes", 75, 15*time.Minute),
+				"search": store.limiter(prefix+"search", search, 15*time.Minute),
+				"lookup": store.limiter(prefix+"lookup", lookup, 15*time.Minute),
+			}
+			return &twitterSource{cred: *cred, timeline: twitterTimeline, limits: limits}
+		},
+	})
+}
+
+var twitterTimeline string
+
+// twitterSource fetches tweets with the API v1.1.
+//
+// timeline is "posts" for the tweets posted by the user, "likes" for the
+// tweets the user liked or "mentions" for the tweets of other people mentioning
+// the user. The API doesn't expose when a tweet was liked, so likes are
+// recorded with the liked tweet's timestamp, which approximates the time the
+// user was reading twitter.
+type twitterSource struct {
+	cred     credentials
+	timeline string
+	limits   map[string]*windowLimiter
+	// tz is the timezone of the user last resolved.
+	tz string
+	pager
+}
+
+// Key stores likes and mentions separately from the user's own tweets so the
+// distributions can be compared.
+func (s *twitterSource) Key(user string) string {
+	if s.timeline != "posts" {
+		return user + "/" + s.timeline
+	}
+	return user
+}
+
+// bearerTransport replaces the OAuth 1.0a signature added by anaconda with an
+// app-only bearer token.
+type bearerTransport struct {
+	bearer string
+	base   http.RoundTripper
+}
+
+func (b *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", "Bearer "+b.bearer)
+	return b.base.RoundTrip(r)
+}
+
+// contextTransport sends the requests with ctx, for anaconda which doesn't
+// take a context.
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (c *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return c.base.RoundTrip(req.WithContext(c.ctx))
+}
+
+// twitterAPI returns a client or errNoCredentials. Its requests are canceled
+// along with ctx.
+//
+// When only a bearer token is provided, the client uses application-only
+// authentication, which can read public timelines but not act as a user.
+func twitterAPI(ctx context.Context, cred *credentials) (*anaconda.TwitterApi, error) {
+	if cred.appOnly() {
+		api := anaconda.NewTwitterApi("", "")
+		api.HttpClient = &http.Client{Transport: &contextTransport{ctx: ctx, base: &bearerTransport{bearer: cred.Bearer, base: apiTransport}}}
+		// apiTransport waits for the quota.
+		api.ReturnRateLimitError(true)
+		return api, nil
+	}
+	if len(cred.Token) == 0 && len(cred.TokenSecret) == 0 {
+		return nil, errNoCredentials
+	}
+	if len(cred.Token) == 0 || len(cred.TokenSecret) == 0 {
+		return nil, errors.New("both -t and -s are required. If you don't have one, visit https://apps.twitter.com/app/new to create a new token.")
+	}
+	setConsumer(cred)
+	api := anaconda.NewTwitterApi(cred.Token, cred.TokenSecret)
+	api.HttpClient = &http.Client{Transport: &contextTransport{ctx: ctx, base: apiTransport}}
+	// apiTransport waits for the quota.
+	api.ReturnRateLimitError(true)
+	return api, nil
+}
+
+var (
+	consumerMu     sync.Mutex
+	consumerKey    string
+	consumerSecret string
+)
+
+// setConsumer sets anaconda's global consumer key and secret. They are only
+// set when they change, as concurrent fetches use them.
+func setConsumer(cred *credentials) {
+	consumerMu.Lock()
+	defer consumerMu.Unlock()
+	if len(cred.ConsumerKey) != 0 && cred.ConsumerKey != consumerKey {
+		anaconda.SetConsumerKey(cred.ConsumerKey)
+		consumerKey = cred.ConsumerKey
+	}
+	if len(cred.ConsumerSecret) != 0 && cred.ConsumerSecret != consumerSecret {
+		anaconda.SetConsumerSecret(cred.ConsumerSecret)
+		consumerSecret = cred.ConsumerSecret
+	}
+}
+
+func (s *twitterSource) Fetch(ctx context.Context, user string, cached []Tweet) ([]Tweet, error) {
+	if s.timeline != "posts" && s.timeline != "likes" && s.timeline != "mentions" {
+		return nil, fmt.Errorf("unknown -timeline %q", s.timeline)
+	}
+	api, err := twitterAPI(ctx, &s.cred)
+	if err != nil {
+		return nil, err
+	}
+	defer api.Close()
+	switch s.timeline {
+	case "likes":
+		// https://developer.twitter.com/en/docs/twitter-api/v1/tweets/post-and-engage/api-reference/get-favorites-list
+		// has the same limits as the user timeline.
+		v := url.Values{
+			"count":            {strconv.Itoa(pageLen(200))},
+			"include_entities": {"true"},
+			"screen_name":      {user},
+		}
+		// That's where the author was, not the user.
+		out, err := fetchPages(ctx, s.limits["likes"], api.GetFavorites, v, cached, false, &s.pager)
+		return out, v1AccountError(err)
+	case "mentions":
+		return search(ctx, s.limits["search"], api, "@"+user+" -from:"+user, cached, false, &s.pager)
+	default:
+		// The important bits of
+		// https://dev.twitter.com/rest/reference/get/statuses/user_timeline are:
+		// - "This method can only return up to 3,200 of a user’s most recent Tweets"
+		// - "count" is limited to 200.
+		// - Maximum 300 requests / 15 minutes.
+		v := url.Values{
+			"contributor_details": {"0"},
+			"count":               {strconv.Itoa(pageLen(200))},
+			"exclude_replies":     {"0"},
+			"trim_user":           {"1"},
+			"include_rts":         {"1"},
+			"screen_name":         {user},
+		}
+		out, err := fetchPages(ctx, s.limits["posts"], api.GetUserTimeline, v, cached, true, &s.pager)
+		return out, v1AccountError(err)
+	}
+}
+
+// v1AccountError returns an accountError if err is the API v1.1 refusing to
+// return the account's tweets, otherwise err.
+func v1AccountError(err error) error {
+	var e *anaconda.ApiError
+	if !errors.As(err, &e) {
+		return err
+	}
+	for _, d := range e.Decoded.Errors {
+		switch d.Code {
+		case anaconda.TwitterErrorCouldNotAuthenticate, anaconda.TwitterErrorInvalidToken, anaconda.TwitterErrorBadAuthenticationData:
+			// The credentials are the problem, not the account.
+			return err
+		}
+	}
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		// That's what the timeline of a protected account returns.
+		return &accountError{reason: "is protected", err: err}
+	case http.StatusForbidden:
+		return &accountError{reason: "is suspended", err: err}
+	case http.StatusNotFound:
+		return &accountError{reason: "doesn't exist", err: err}
+	}
+	return err
+}
+
+// Resolve implements Resolver.
+func (s *twitterSource) Resolve(ctx context.Context, user string) (string, error) {
+	api, err := twitterAPI(ctx, &s.cred)
+	if err != nil {
+		return "", err
+	}
+	defer api.Close()
+	u, err := api.GetUsersShow(user, nil)
+	if err != nil {
+		return "", v1AccountError(err)
+	}
+	// utc_offset is 0 when time_zone isn't set, which twitter.com stopped
+	// returning in 2018.
+	s.tz = ""
+	if len(u.TimeZone) != 0 {
+		s.tz = offsetZone(u.UtcOffset)
+	}
+	return "id:" + u.IdStr, nil
+}
+
+// Timezone implements Timezoner.
+func (s *twitterSource) Timezone() string {
+	return s.tz
+}
+
+// Search implements Searcher.
+func (s *twitterSource) Search(ctx context.Context, query string, cached []Tweet) ([]Tweet, error) {
+	api, err := twitterAPI(ctx, &s.cred)
+	if err != nil {
+		return nil, err
+	}
+	defer api.Close()
+	return search(ctx, s.limits["search"], api, query, cached, true, &s.pager)
+}
+
+// Members implements Lister. list is "owner/slug".
+func (s *twitterSource) Members(ctx context.Context, list string) ([]string, error) {
+	i := strings.IndexByte(list, '/')
+	if i <= 0 || i == len(list)-1 {
+		return nil, fmt.Errorf("invalid list %q; expected owner/slug", list)
+	}
+	if !s.cred.appOnly() && (len(s.cred.Token) == 0 || len(s.cred.TokenSecret) == 0) {
+		return nil, errors.New("-t and -s or -bearer are required to fetch a list")
+	}
+	// anaconda doesn't implement lists/members.
+	// https://developer.twitter.com/en/docs/twitter-api/v1/accounts-and-users/create-manage-lists/api-reference/get-lists-members
+	// - "count" is limited to 5000.
+	// - Maximum 900 requests / 15 minutes.
+	v := url.Values{
+		"owner_screen_name": {list[:i]},
+		"slug":              {list[i+1:]},
+		"count":             {"5000"},
+		"skip_status":       {"1"},
+		"include_entities":  {"false"},
+	}
+	var out []string
+	for {
+		var page anaconda.UserCursor
+		if _, err := getV1(ctx, &s.cred, "/lists/members.json", v, &page); err != nil {
+			return nil, err
+		}
+		for _, u := range page.Users {
+			out = append(out, u.ScreenName)
+		}
+		if page.Next_cursor_str == "" || page.Next_cursor_str == "0" {
+			return out, nil
+		}
+		v.Set("cursor", page.Next_cursor_str)
+	}
+}
+
+// Existing implements Verifier.
+func (s *twitterSource) Existing(ctx context.Context, ids []int64) (map[int64]bool, error) {
+	api, err := twitterAPI(ctx, &s.cred)
+	if err != nil {
+		return nil, err
+	}
+	// https://developer.twitter.com/en/docs/twitter-api/v1/tweets/post-and-engage/api-reference/get-statuses-lookup
+	// omits the deleted tweets and those of suspended or protected accounts,
+	// up to 100 tweets per request.
+	out := map[int64]bool{}
+	v := url.Values{"include_entities": {"false"}, "trim_user": {"1"}}
+	for len(ids) != 0 {
+		n := len(ids)
+		if n > 100 {
+			n = 100
+		}
+		if err := s.limits["lookup"].wait(ctx); err != nil {
+			return nil, err
+		}
+		slog.Debug("Looking up tweets", "count", n)
+		tweets, err := api.GetTweetsLookupByIds(ids[:n], v)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tweets {
+			out[t.Id] = true
+		}
+		ids = ids[n:]
+	}
+	return out, nil
+}
+
+// getV1 does a GET request on an API v1.1 endpoint signed with cred and
+// decodes the JSON response into out. It is used for what anaconda doesn't
+// implement or when the response headers are needed.
+func getV1(ctx context.Context, cred *credentials, endpoint string, v url.Values, out interface{}) (http.Header, error) {
+	client := oauth.Client{Credentials: oauth.Credentials{Token: cred.ConsumerKey, Secret: cred.ConsumerSecret}}
+	token := &oauth.Credentials{Token: cred.Token, Secret: cred.TokenSecret}
+	hc := apiClient
+	if cred.appOnly() {
+		hc = &http.Client{Transport: &bearerTransport{bearer: cred.Bearer, base: apiTransport}}
+	}
+	resp, err := client.GetContext(context.WithValue(ctx, oauth.HTTPClient, hc), token, anaconda.BaseUrl+endpoint, v)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return resp.Header, &statusError{url: endpoint, code: resp.StatusCode, status: resp.Status, body: b}
+	}
+	return resp.Header, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// search returns the recent tweets matching query.
+func search(ctx context.Context, l *windowLimiter, api *anaconda.TwitterApi, query string, cached []Tweet, places bool, p *pager) ([]Tweet, error) {
+	// https://developer.twitter.com/en/docs/twitter-api/v1/tweets/search/api-reference/get-search-tweets
+	// - Only the tweets of the last 7 days are searched.
+	// - "count" is limited to 100.
+	// - Maximum 180 requests / 15 minutes.
+	v := url.Values{
+		"count":            {strconv.Itoa(pageLen(100))},
+		"include_entities": {"true"},
+		"result_type":      {"recent"},
+	}
+	get := func(v url.Values) ([]anaconda.Tweet, error) {
+		r, err := api.GetSearch(query, v)
+		return r.Statuses, err
+	}
+	return fetchPages(ctx, l, get, v, cached, places, p)
+}
+
+// fetchPages pages backward with max_id through the tweets returned by get,
+// starting before the oldest cached tweet. Each page is passed to p as it is
+// retrieved.
+func fetchPages(ctx context.Context, l *windowLimiter, get func(v url.Values) ([]anaconda.Tweet, error), v url.Values, cached []Tweet, places bool, p *pager) ([]Tweet, error) {
+	// Otherwise the text is truncated to 140 characters and the entities past
+	// it are missing.
+	v.Set("tweet_mode", "extended")
+	var out []Tweet
+	// cursor is "<since_id>:<max_id>" while the pass over the tweets newer than
+	// the cache is not complete.
+	cursor := ""
+	add := func(out []Tweet, timeline []anaconda.Tweet) ([]Tweet, error) {
+		n := len(out)
+		out, err := appendV1Tweets(out, timeline, places)
+		if err == nil {
+			p.page(out[n:], cursor)
+		}
+		return out, err
+	}
+	var since, max int64
+	if first, ok := newest(cached); ok {
+		since = first.Id
+	}
+	if s, m, ok := strings.Cut(p.resume, ":"); ok {
+		// Resume the interrupted pass where it stopped.
+		since, _ = strconv.ParseInt(s, 10, 64)
+		max, _ = strconv.ParseInt(m, 10, 64)
+	}
+	if since != 0 {
+		// Pick up the tweets posted since the last run first, paging backward
+		// down to the most recent cached tweet.
+		slog.Debug("Using since_id", "since_id", since)
+		v.Set("since_id", strconv.FormatInt(since, 10))
+		for i := 0; i < pageCount(10) && !enough(len(out)); i++ {
+			if max != 0 {
+				slog.Debug("Using max_id", "max_id", max)
+				v.Set("max_id", strconv.FormatInt(max, 10))
+			}
+			if err := l.wait(ctx); err != nil {
+				return nil, err
+			}
+			slog.Debug("Fetching")
+			timeline, err := get(v)
+			slog.Debug("Retrieved tweets", "count", len(timeline))
+			if err != nil {
+				return nil, err
+			}
+			if len(timeline) == 0 {
+				cursor = ""
+				p.page(nil, cursor)
+				break
+			}
+			max = timeline[len(timeline)-1].Id - 1
+			cursor = fmt.Sprintf("%d:%d", since, max)
+			if out, err = add(out, timeline); err != nil {
+				return nil, err
+			}
+		}
+		v.Del("since_id")
+		v.Del("max_id")
+	}
+	if storeEngagement && len(cached) != 0 {
+		// Refresh the counts of the most recent tweets, which are still
+		// changing.
+		if err := l.wait(ctx); err != nil {
+			return nil, err
+		}
+		slog.Debug("Fetching the most recent tweets")
+		timeline, err := get(v)
+		if err != nil {
+			return nil, err
+		}
+		if out, err = add(out, timeline); err != nil {
+			return nil, err
+		}
+	}
+	last, ok := oldest(cached)
+	for i := 0; i < pageCount(10) && !enough(len(out)); i++ {
+		if ok {
+			m := strconv.FormatInt(last.Id-1, 10)
+			slog.Debug("Using max_id", "max_id", m)
+			v["max_id"] = []string{m}
+		}
+		if err := l.wait(ctx); err != nil {
+			return out, err
+		}
+		slog.Debug("Fetching")
+		timeline, err := get(v)
+		slog.Debug("Retrieved tweets", "count", len(timeline))
+		if err != nil {
+			// The transient errors were already retried.
+			return out, err
+		}
+		if len(timeline) == 0 {
+			break
+		}
+		if out, err = add(out, timeline); err != nil {
+			return nil, err
+		}
+		// Assumes tweets are in order.
+		last, ok = out[len(out)-1], true
+	}
+	return out, nil
+}
+
+// appendV1Tweets converts timeline and appends it to out. The location is
+// only kept when places is true.
+func appendV1Tweets(out []Tweet, timeline []anaconda.Tweet, places bool) ([]Tweet, error) {
+	for _, tweet := range timeline {
+		t, err := tweet.CreatedAtTime()
+		if err != nil {
+			return nil, err
+		}
+		place := ""
+		var geo *LatLong
+		if places {
+			place = tweet.Place.Name
+			geo = tweetGeo(tweet.Coordinates, tweet.Place.BoundingBox.Coordinates)
+		}
+		out = append(out, Tweet{
+			CreatedAt: t,
+			Id:        tweet.Id,
+			Place:     place,
+			Text:      tweet.FullText,
+			Source:    clientName(tweet.Source),
+			Geo:       geo,
+			Likes:     tweet.FavoriteCount,
+			Retweets:  tweet.RetweetCount,
+			Kind:      tweetKind(tweet.InReplyToStatusID != 0, tweet.RetweetedStatus != nil, tweet.QuotedStatusID != 0),
+		})
+		setV1Entities(&out[len(out)-1], &tweet.Entities, &tweet.ExtendedEntities)
+	}
+	return out, nil
+}
+
+// setV1Entities sets the entities of t from a v1.1 tweet. ext lists all the
+// media while e only lists the first one.
+func setV1Entities(t *Tweet, e, ext *anaconda.Entities) {
+	t.Hashtags, t.Mentions, t.URLs = nil, nil, nil
+	for _, h := range e.Hashtags {
+		t.Hashtags = append(t.Hashtags, h.Text)
+	}
+	for _, m := range e.User_mentions {
+		t.Mentions = append(t.Mentions, m.Screen_name)
+	}
+	for _, u := range e.Urls {
+		t.URLs = append(t.URLs, u.Expanded_url)
+	}
+	t.Media = len(ext.Media)
+	if t.Media == 0 {
+		t.Media = len(e.Media)
+	}
+}
+
+// clientName returns the name of the client from the source field of a v1.1
+// tweet, which is an HTML link like
+// <a href="http://twitter.com/download/iphone" rel="nofollow">Twitter for iPhone</a>.
+func clientName(source string) string {
+	if i := strings.IndexByte(source, '>'); i != -1 && strings.HasPrefix(source, "<a") {
+		source = strings.TrimSuffix(source[i+1:], "</a>")
+	}
+	return html.UnescapeString(source)
+}
+
+// tweetGeo returns the exact coordinates of a v1.1 tweet, or else the center
+// of its place's bounding box. It returns nil when the tweet has neither.
+func tweetGeo(c *anaconda.Coordinates, bbox [][][]float64) *LatLong {
+	if c != nil && c.Type == "Point" {
+		// GeoJSON is longitude first.
+		return &LatLong{Lat: c.Coordinates[1], Long: c.Coordinates[0], Exact: true}
+	}
+	if len(bbox) == 0 || len(bbox[0]) == 0 {
+		return nil
+	}
+	w, s, e, n := bbox[0][0][0], bbox[0][0][1], bbox[0][0][0], bbox[0][0][1]
+	for _, p := range bbox[0][1:] {
+		w, e = math.Min(w, p[0]), math.Max(e, p[0])
+		s, n = math.Min(s, p[1]), math.Max(n, p[1])
+	}
+	return &LatLong{Lat: (s + n) / 2, Long: (w + e) / 2}
+}
@@ -0,0 +1,343 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+const twitterV2URL = "https://api.twitter.com/2"
+
+// getJSON does a GET request on u and decodes the JSON response into out.
+//
+// If bearer is not empty, it is sent as the Authorization header.
+func getJSON(ctx context.Context, u, bearer string, out interface{}) error {
+	_, err := getJSONHeader(ctx, u, bearer, out)
+	return err
+}
+
+// getJSONHeader is like getJSON but also returns the response headers, e.g.
+// to read rate limiting information.
+func getJSONHeader(ctx context.Context, u, bearer string, out interface{}) (http.Header, error) {
+	req, err := newRequest(ctx, u, bearer)
+	if err != nil {
+		return nil, err
+	}
+	return doJSON(req, out)
+}
+
+// newRequest returns a GET request on u.
+func newRequest(ctx context.Context, u, bearer string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Some APIs like reddit's reject requests without a descriptive user agent.
+	req.Header.Set("User-Agent", "github.com/maruel/restroom")
+	if len(bearer) != 0 {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	return req, nil
+}
+
+// doJSON sends req and decodes the JSON response into out.
+func doJSON(req *http.Request, out interface{}) (http.Header, error) {
+	resp, err := apiClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return resp.Header, &statusError{url: req.URL.String(), code: resp.StatusCode, status: resp.Status, body: b}
+	}
+	return resp.Header, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// v2Error is an error as returned by the API v2.
+type v2Error struct {
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+}
+
+// v2Reasons are the titles of the API v2 errors about the account queried.
+var v2Reasons = map[string]string{
+	"Authorization Error": "is protected",
+	"Forbidden":           "is suspended",
+	"Not Found Error":     "doesn't exist",
+}
+
+// err returns e as an error, an accountError if it is about the account.
+func (e *v2Error) err() error {
+	err := fmt.Errorf("%s: %s", e.Title, e.Detail)
+	if r, ok := v2Reasons[e.Title]; ok {
+		return &accountError{reason: r, err: err}
+	}
+	return err
+}
+
+type v2User struct {
+	Data struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"data"`
+	Errors []v2Error `json:"errors"`
+}
+
+type v2Timeline struct {
+	Data []struct {
+		ID        string    `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+		Text      string    `json:"text"`
+		Source    string    `json:"source"`
+		// ReferencedTweets have a type: replied_to, retweeted or quoted.
+		ReferencedTweets []struct {
+			Type string `json:"type"`
+		} `json:"referenced_tweets"`
+		Metrics struct {
+			Likes    int `json:"like_count"`
+			Retweets int `json:"retweet_count"`
+		} `json:"public_metrics"`
+		Entities struct {
+			Hashtags []struct {
+				Tag string `json:"tag"`
+			} `json:"hashtags"`
+			Mentions []struct {
+				Username string `json:"username"`
+			} `json:"mentions"`
+			URLs []struct {
+				ExpandedURL string `json:"expanded_url"`
+				// MediaKey is set for the links to the attached media.
+				MediaKey string `json:"media_key"`
+			} `json:"urls"`
+		} `json:"entities"`
+		Attachments struct {
+			MediaKeys []string `json:"media_keys"`
+		} `json:"attachments"`
+		Geo struct {
+			PlaceID     string `json:"place_id"`
+			Coordinates *struct {
+				Type        string     `json:"type"`
+				Coordinates [2]float64 `json:"coordinates"`
+			} `json:"coordinates"`
+		} `json:"geo"`
+	} `json:"data"`
+	Includes struct {
+		Places []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+			Geo  struct {
+				// West, south, east, north.
+				BBox []float64 `json:"bbox"`
+			} `json:"geo"`
+		} `json:"places"`
+	} `json:"includes"`
+	Meta struct {
+		ResultCount int    `json:"result_count"`
+		NextToken   string `json:"next_token"`
+	} `json:"meta"`
+	Errors []v2Error `json:"errors"`
+}
+
+func init() {
+	registerSource("twitter2", sourceDef{
+		new: func(cred *credentials) Source { return &twitter2Source{bearer: cred.Bearer, profile: cred.Profile} },
+	})
+}
+
+// twitter2Source fetches tweets with the API v2 using an app-only bearer
+// token, or the OAuth 2.0 user context saved by "restroom auth -oauth2".
+type twitter2Source struct {
+	bearer  string
+	profile string
+	pager
+}
+
+// token returns the token to authenticate with. The OAuth 2.0 token is shared
+// by all the sources and refreshed when it expires.
+func (t *twitter2Source) token() (string, error) {
+	if len(t.bearer) != 0 {
+		return t.bearer, nil
+	}
+	return oauth2Token(t.profile)
+}
+
+// getJSON is getJSON with the token. The OAuth 2.0 token is refreshed and the
+// request retried once if the token is rejected, e.g. when it was revoked.
+func (t *twitter2Source) getJSON(ctx context.Context, u string, out interface{}) error {
+	tok, err := t.token()
+	if err != nil {
+		return err
+	}
+	err = getJSON(ctx, u, tok, out)
+	var se *statusError
+	if len(t.bearer) == 0 && errors.As(err, &se) && se.code == http.StatusUnauthorized {
+		slog.Info("The OAuth 2.0 token was rejected")
+		if tok, _, err = oauth2TokenScope(t.profile, tok); err != nil {
+			return err
+		}
+		err = getJSON(ctx, u, tok, out)
+	}
+	return err
+}
+
+// Key returns the same key as the API v1.1 since the tweets are the same.
+func (t *twitter2Source) Key(user string) string {
+	return user
+}
+
+// userID returns the ID of a user.
+func (t *twitter2Source) userID(ctx context.Context, user string) (string, error) {
+	var u v2User
+	if err := t.getJSON(ctx, twitterV2URL+"/users/by/username/"+url.PathEscape(user), &u); err != nil {
+		return "", err
+	}
+	if len(u.Data.ID) == 0 {
+		if len(u.Errors) != 0 {
+			return "", u.Errors[0].err()
+		}
+		return "", &accountError{reason: "doesn't exist", err: errors.New("user not found")}
+	}
+	slog.Debug("Resolved user", "user", user, "id", u.Data.ID)
+	return u.Data.ID, nil
+}
+
+// Resolve implements Resolver, with the same IDs as the API v1.1.
+func (t *twitter2Source) Resolve(ctx context.Context, user string) (string, error) {
+	id, err := t.userID(ctx, user)
+	if err != nil {
+		return "", err
+	}
+	return "id:" + id, nil
+}
+
+func (t *twitter2Source) Fetch(ctx context.Context, user string, cached []Tweet) ([]Tweet, error) {
+	// The important bits of
+	// https://developer.twitter.com/en/docs/twitter-api/tweets/timelines/api-reference/get-users-id-tweets
+	// are:
+	// - Only the 3,200 most recent Tweets are available.
+	// - "max_results" is limited to 100.
+	// - Maximum 1500 requests / 15 minutes per app.
+	id, err := t.userID(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	v := url.Values{
+		"max_results":  {strconv.Itoa(pageLen(100))},
+		"tweet.fields": {"attachments,created_at,entities,geo,public_metrics,referenced_tweets,source"},
+		"expansions":   {"geo.place_id"},
+		"place.fields": {"name,geo"},
+	}
+	var out []Tweet
+	since := ""
+	if first, ok := newest(cached); ok {
+		since = strconv.FormatInt(first.Id, 10)
+	}
+	if s, tok, ok := strings.Cut(t.resume, ":"); ok {
+		// Resume the interrupted pass where it stopped.
+		since = s
+		v.Set("pagination_token", tok)
+	}
+	if len(since) != 0 {
+		// Pick up the tweets posted since the last run first.
+		slog.Debug("Using since_id", "since_id", since)
+		v.Set("since_id", since)
+		if out, err = t.pages(ctx, id, v, since); err != nil {
+			return nil, err
+		}
+		v.Del("since_id")
+		v.Del("pagination_token")
+	}
+	if last, ok := oldest(cached); ok {
+		m := strconv.FormatInt(last.Id, 10)
+		slog.Debug("Using until_id", "until_id", m)
+		v.Set("until_id", m)
+	}
+	older, err := t.pages(ctx, id, v, "")
+	return append(out, older...), err
+}
+
+// pages returns up to 10 pages of the tweets of the user id matching v. since
+// is the since_id of the pass over the tweets newer than the cache, to resume
+// it if interrupted.
+func (t *twitter2Source) pages(ctx context.Context, id string, v url.Values, since string) ([]Tweet, error) {
+	var out []Tweet
+	for i := 0; i < pageCount(10) && !enough(len(out)); i++ {
+		slog.Debug("Fetching")
+		var tl v2Timeline
+		if err := t.getJSON(ctx, twitterV2URL+"/users/"+id+"/tweets?"+v.Encode(), &tl); err != nil {
+			// The transient errors were already retried.
+			return out, err
+		}
+		if len(tl.Data) == 0 && len(tl.Errors) != 0 {
+			return out, tl.Errors[0].err()
+		}
+		slog.Debug("Retrieved tweets", "count", len(tl.Data))
+		places := map[string]string{}
+		centers := map[string]*LatLong{}
+		for _, p := range tl.Includes.Places {
+			places[p.ID] = p.Name
+			if b := p.Geo.BBox; len(b) == 4 {
+				centers[p.ID] = &LatLong{Lat: (b[1] + b[3]) / 2, Long: (b[0] + b[2]) / 2}
+			}
+		}
+		n := len(out)
+		for _, tweet := range tl.Data {
+			id, err := strconv.ParseInt(tweet.ID, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tweet id %q: %w", tweet.ID, err)
+			}
+			geo := centers[tweet.Geo.PlaceID]
+			if c := tweet.Geo.Coordinates; c != nil && c.Type == "Point" {
+				geo = &LatLong{Lat: c.Coordinates[1], Long: c.Coordinates[0], Exact: true}
+			}
+			t := Tweet{CreatedAt: tweet.CreatedAt, Id: id, Place: places[tweet.Geo.PlaceID], Text: tweet.Text, Source: tweet.Source, Geo: geo, Likes: tweet.Metrics.Likes, Retweets: tweet.Metrics.Retweets, Media: len(tweet.Attachments.MediaKeys)}
+			var reply, retweet, quote bool
+			for _, r := range tweet.ReferencedTweets {
+				reply = reply || r.Type == "replied_to"
+				retweet = retweet || r.Type == "retweeted"
+				quote = quote || r.Type == "quoted"
+			}
+			t.Kind = tweetKind(reply, retweet, quote)
+			for _, h := range tweet.Entities.Hashtags {
+				t.Hashtags = append(t.Hashtags, h.Tag)
+			}
+			for _, m := range tweet.Entities.Mentions {
+				t.Mentions = append(t.Mentions, m.Username)
+			}
+			for _, u := range tweet.Entities.URLs {
+				if len(u.MediaKey) == 0 {
+					t.URLs = append(t.URLs, u.ExpandedURL)
+				}
+			}
+			out = append(out, t)
+		}
+		// Keep the cursor of an incomplete pass over the newer tweets.
+		cursor := t.cursor
+		if len(since) != 0 {
+			cursor = ""
+			if len(tl.Meta.NextToken) != 0 {
+				cursor = since + ":" + tl.Meta.NextToken
+			}
+		}
+		t.page(out[n:], cursor)
+		if len(tl.Meta.NextToken) == 0 {
+			break
+		}
+		v.Set("pagination_token", tl.Meta.NextToken)
+	}
+	return out, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/exp/slog"
+)
+
+// usersCmd runs the users subcommands.
+func usersCmd(args []string) error {
+	if len(args) != 0 && args[0] == "rm" {
+		return removeUsers(args[1:])
+	}
+	return listUsers(args)
+}
+
+// listUsers lists the users in the cache.
+func listUsers(args []string) error {
+	f := flag.NewFlagSet("users", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "usage: restroom users\n")
+		fmt.Fprintf(f.Output(), "       restroom users rm [-f] <user>...\n")
+		f.PrintDefaults()
+	}
+	registerStore(f)
+	logs := registerLog(f)
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+
+	if err := logs.apply(); err != nil {
+		return err
+	}
+	if f.NArg() != 0 {
+		return errors.New("unexpected argument")
+	}
+	c := load()
+	keys, err := c.store.Users()
+	if err != nil {
+		return err
+	}
+	names := c.displayNames()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "USER\tTWEETS\tFROM\tTO\n")
+	for _, k := range keys {
+		l := c.get(k)
+		if len(l) == 0 {
+			continue
+		}
+		name := k
+		if n, ok := names[k]; ok {
+			name = n
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", name, len(l), l[len(l)-1].CreatedAt.Format("2006-01-02"), l[0].CreatedAt.Format("2006-01-02"))
+	}
+	return w.Flush()
+}
+
+// displayNames returns the names to print for the cache keys derived from the
+// immutable user IDs, which are not meaningful, with the names they were
+// fetched as.
+func (c *cache) displayNames() map[string]string {
+	aliases := map[string][]string{}
+	for k, v := range c.Aliases {
+		aliases[v] = append(aliases[v], k)
+	}
+	out := make(map[string]string, len(aliases))
+	for k, n := range aliases {
+		sort.Strings(n)
+		out[k] = strings.Join(n, ", ") + " (" + k + ")"
+	}
+	return out
+}
+
+// removeUsers removes the tweets and the metadata of users from the cache.
+func removeUsers(args []string) error {
+	f := flag.NewFlagSet("users rm", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "usage: restroom users rm [-f] <user>...\n")
+		f.PrintDefaults()
+	}
+	force := f.Bool("f", false, "do not ask for confirmation")
+	registerStore(f)
+	logs := registerLog(f)
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+
+	if err := logs.apply(); err != nil {
+		return err
+	}
+	if f.NArg() == 0 {
+		return errors.New("expected the users to remove, as printed by restroom users")
+	}
+	c := load()
+	var keys []string
+	total := 0
+	for _, u := range f.Args() {
+		k := c.resolve(u)
+		l := c.get(k)
+		_, fetched := c.Fetched[k]
+		if len(l) == 0 && !fetched {
+			return fmt.Errorf("%s is not in the cache", u)
+		}
+		keys = append(keys, k)
+		total += len(l)
+	}
+	if !*force {
+		fmt.Fprintf(os.Stderr, "Remove %d tweets of %s? [y/N] ", total, strings.Join(f.Args(), ", "))
+		a, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if a = strings.ToLower(strings.TrimSpace(a)); a != "y" && a != "yes" {
+			return errors.New("aborted")
+		}
+	}
+	for _, k := range keys {
+		slog.Info("Removing", "user", k)
+		if err := c.store.RemoveUser(k); err != nil {
+			return err
+		}
+		delete(c.Fetched, k)
+		delete(c.Cursors, k)
+		delete(c.Timezones, k)
+		for a, v := range c.Aliases {
+			if v == k {
+				delete(c.Aliases, a)
+			}
+		}
+	}
+	c.save()
+	if cp, ok := c.store.(compacter); ok {
+		if err := cp.Compact(); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Removed %d tweets\n", total)
+	return nil
+}
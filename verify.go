@@ -0,0 +1,124 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rateLimitStatus is the response of application/rate_limit_status.
+type rateLimitStatus struct {
+	Resources map[string]map[string]struct {
+		Limit     int   `json:"limit"`
+		Remaining int   `json:"remaining"`
+		Reset     int64 `json:"reset"`
+	} `json:"resources"`
+}
+
+// verifyCredentials is the "auth verify" subcommand. It checks the
+// credentials that would be used to fetch and prints what they give access
+// to.
+func verifyCredentials(args []string) error {
+	f := flag.NewFlagSet("auth verify", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "usage: restroom auth verify\n")
+		f.PrintDefaults()
+	}
+	cred := registerCredentials(f)
+	proxy := registerProxy(f)
+	logs := registerLog(f)
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+
+	if err := logs.apply(); err != nil {
+		return err
+	}
+	if f.NArg() != 0 {
+		return errors.New("unexpected argument")
+	}
+	if err := setProxy(*proxy); err != nil {
+		return err
+	}
+	if err := cred.loadDefaults(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if len(cred.Token) != 0 || len(cred.TokenSecret) != 0 || cred.appOnly() {
+		return verifyV1(ctx, cred)
+	}
+	tok, scope, err := oauth2TokenScope(cred.Profile, "")
+	if err == errNoCredentials {
+		return errors.New("no credentials found; run restroom auth first")
+	}
+	if err != nil {
+		return err
+	}
+	// https://developer.twitter.com/en/docs/twitter-api/users/lookup/api-reference/get-users-me
+	var u v2User
+	h, err := getJSONHeader(ctx, twitterV2URL+"/users/me", tok, &u)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Authenticated as @%s (id %s) with OAuth 2.0\n", u.Data.Username, u.Data.ID)
+	fmt.Printf("Scopes: %s\n", scope)
+	fmt.Printf("Rate limit of /2/users/me: %s/%s\n", h.Get("X-Rate-Limit-Remaining"), h.Get("X-Rate-Limit-Limit"))
+	return nil
+}
+
+// verifyV1 verifies OAuth 1.0a or app-only credentials with the API v1.1.
+func verifyV1(ctx context.Context, cred *credentials) error {
+	if cred.appOnly() {
+		fmt.Printf("Authenticated with an app-only bearer token\n")
+	} else {
+		if len(cred.Token) == 0 || len(cred.TokenSecret) == 0 {
+			return errors.New("both -t and -s are required")
+		}
+		// https://developer.twitter.com/en/docs/twitter-api/v1/accounts-and-users/manage-account-settings/api-reference/get-account-verify_credentials
+		var u struct {
+			ID         string `json:"id_str"`
+			ScreenName string `json:"screen_name"`
+		}
+		v := url.Values{"skip_status": {"1"}, "include_entities": {"false"}}
+		h, err := getV1(ctx, cred, "/account/verify_credentials.json", v, &u)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Authenticated as @%s (id %s) with OAuth 1.0a\n", u.ScreenName, u.ID)
+		fmt.Printf("Access level: %s\n", h.Get("X-Access-Level"))
+	}
+	// https://developer.twitter.com/en/docs/twitter-api/v1/developer-utilities/rate-limit-status/api-reference/get-application-rate_limit_status
+	var r rateLimitStatus
+	v := url.Values{"resources": {"statuses,favorites,search,lists,users"}}
+	if _, err := getV1(ctx, cred, "/application/rate_limit_status.json", v, &r); err != nil {
+		return err
+	}
+	fmt.Printf("Rate limits:\n%s\n", strings.Join(r.lines(nil), "\n"))
+	return nil
+}
+
+// lines formats the limits of the endpoints, sorted. Only the endpoints for
+// which keep returns true are included, if keep is not nil.
+func (r *rateLimitStatus) lines(keep func(endpoint string) bool) []string {
+	var lines []string
+	for _, res := range r.Resources {
+		for endpoint, l := range res {
+			if keep != nil && !keep(endpoint) {
+				continue
+			}
+			reset := time.Unix(l.Reset, 0).UTC().Format("15:04:05")
+			lines = append(lines, fmt.Sprintf("  %-40s %5d/%-5d reset at %s UTC", endpoint, l.Remaining, l.Limit, reset))
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
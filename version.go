@@ -0,0 +1,98 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// buildDate is set with -ldflags "-X main.buildDate=$(date -u +%FT%TZ)".
+var buildDate string
+
+// buildInfo is the version information embedded by the Go toolchain.
+type buildInfo struct {
+	// module is the module version, "(devel)" when built from a checkout.
+	module   string
+	commit   string
+	time     string
+	modified bool
+	goVer    string
+}
+
+func readBuildInfo() buildInfo {
+	b := buildInfo{module: "(devel)", goVer: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	if len(bi.Main.Version) != 0 {
+		b.module = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.commit = s.Value
+		case "vcs.time":
+			b.time = s.Value
+		case "vcs.modified":
+			b.modified = s.Value == "true"
+		}
+	}
+	return b
+}
+
+// version returns a one-line version of restroom, recorded in the files it
+// writes.
+func version() string {
+	b := readBuildInfo()
+	v := "restroom " + b.module
+	if b.module == "(devel)" && len(b.commit) != 0 {
+		c := b.commit
+		if len(c) > 12 {
+			c = c[:12]
+		}
+		v += " " + c
+		if b.modified {
+			v += "-dirty"
+		}
+	}
+	return v
+}
+
+// versionCmd prints the version of restroom.
+func versionCmd(args []string) error {
+	f := flag.NewFlagSet("version", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "usage: restroom version\n")
+		f.PrintDefaults()
+	}
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+	if f.NArg() != 0 {
+		return errors.New("unexpected argument")
+	}
+	b := readBuildInfo()
+	fmt.Printf("restroom %s\n", b.module)
+	if len(b.commit) != 0 {
+		m := ""
+		if b.modified {
+			m = " (modified)"
+		}
+		fmt.Printf("commit:  %s%s\n", b.commit, m)
+	}
+	if len(b.time) != 0 {
+		fmt.Printf("date:    %s\n", b.time)
+	}
+	if len(buildDate) != 0 {
+		fmt.Printf("built:   %s\n", buildDate)
+	}
+	fmt.Printf("go:      %s %s/%s\n", b.goVer, runtime.GOOS, runtime.GOARCH)
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// watchCmd fetches and prints the stats periodically until interrupted.
+func watchCmd(args []string) error {
+	f := flag.NewFlagSet("watch", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "usage: restroom watch [-u <user> | -q <query> | -list <owner/slug> | -users-file <file>] [-interval <duration>]\n")
+		f.PrintDefaults()
+	}
+	o := registerFetch(f)
+	so := registerStats(f, true)
+	interval := f.Duration("interval", time.Hour, "how often to fetch and redraw the stats")
+	registerColor(f)
+	registerStore(f)
+	logs := registerLog(f)
+	if err := parseFlags(f, args); err != nil {
+		return err
+	}
+
+	if err := logs.apply(); err != nil {
+		return err
+	}
+	if f.NArg() != 0 {
+		return errors.New("unexpected argument")
+	}
+	if *interval <= 0 {
+		return errors.New("-interval must be positive")
+	}
+	if err := so.parse(); err != nil {
+		return err
+	}
+	refresh := false
+	f.Visit(func(fl *flag.Flag) { refresh = refresh || fl.Name == "refresh" })
+	if !refresh {
+		// Each round fetches all the users of -users-file.
+		o.refresh = 0
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c := load()
+	defer c.save()
+	clear := term.IsTerminal(int(os.Stdout.Fd()))
+	for {
+		keys, err := o.fetch(c)
+		if err == errInterrupted {
+			return err
+		}
+		c.save()
+		if clear {
+			fmt.Print("\033[H\033[2J")
+		}
+		next := time.Now().Add(*interval)
+		if err != nil {
+			// The next round may succeed, e.g. after a network outage.
+			warnf("%s; retrying at %s", err, next.Format("15:04"))
+		} else {
+			fmt.Printf("Updated at %s; next update at %s.\n\n", time.Now().Format("15:04"), next.Format("15:04"))
+			if err := so.report(c, o.targets, keys); err != nil {
+				return err
+			}
+		}
+		if sleep(ctx, *interval) != nil {
+			return nil
+		}
+	}
+}